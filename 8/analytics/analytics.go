@@ -0,0 +1,105 @@
+// Package analytics scores the state of a city with inequality and welfare metrics
+package analytics
+
+import (
+	"math"
+	"sort"
+
+	"github.com/jasonfantl/SimulatedEconomy8/economy"
+)
+
+// Metrics describe how well off a city is, and how evenly
+type Metrics struct {
+	MoneyGini          float64 // 0 is perfect equality, 1 is one local owning everything
+	NetWorthGini       float64 // money plus goods valued at each local's expected market price
+	TopTenPercentShare float64 // fraction of the total net worth owned by the richest tenth of locals
+	TotalUtility       float64 // summed over every good each local owns
+	LeisureTaken       int     // times locals chose to do nothing during the last tick
+	MeanLeisureStreak  float64 // how many times in a row locals have been doing nothing, on average
+}
+
+// Names are the column names used when recording metrics, in the same order as Values
+var Names = []string{"money_gini", "net_worth_gini", "top_ten_percent_share", "total_utility", "leisure_taken", "mean_leisure_streak"}
+
+// Values returns the metrics in the same order as Names
+func (metrics Metrics) Values() []float64 {
+	return []float64{
+		metrics.MoneyGini,
+		metrics.NetWorthGini,
+		metrics.TopTenPercentShare,
+		metrics.TotalUtility,
+		float64(metrics.LeisureTaken),
+		metrics.MeanLeisureStreak,
+	}
+}
+
+// Compute measures a city as it is right now
+func Compute(city *economy.City) Metrics {
+	locals := city.Locals()
+	money := make([]float64, len(locals))
+	netWorth := make([]float64, len(locals))
+	metrics := Metrics{LeisureTaken: city.LeisureTaken()}
+
+	for i, local := range locals {
+		money[i] = local.Money()
+		netWorth[i] = local.Money()
+		for _, good := range city.Goods() {
+			netWorth[i] += float64(local.Owned(good)) * local.ExpectedPrice(good)
+			metrics.TotalUtility += local.Utility(good)
+		}
+		metrics.TotalUtility += local.Utility(economy.LEISURE)
+		metrics.MeanLeisureStreak += float64(local.Owned(economy.LEISURE))
+	}
+	if len(locals) > 0 {
+		metrics.MeanLeisureStreak /= float64(len(locals))
+	}
+
+	metrics.MoneyGini = Gini(money)
+	metrics.NetWorthGini = Gini(netWorth)
+	metrics.TopTenPercentShare = TopShare(netWorth, 0.1)
+
+	return metrics
+}
+
+// Record adds the metrics of every city to a recorder
+func Record(recorder *economy.Recorder) {
+	recorder.AddMetrics(Names, func(city *economy.City) []float64 {
+		return Compute(city).Values()
+	})
+}
+
+// Gini is the Gini coefficient of the values, 0 if there are none or they sum to 0
+func Gini(values []float64) float64 {
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+
+	n := float64(len(sorted))
+	sum, weightedSum := 0.0, 0.0
+	for i, v := range sorted {
+		sum += v
+		weightedSum += float64(i+1) * v
+	}
+	if n == 0 || sum == 0 {
+		return 0
+	}
+	return 2*weightedSum/(n*sum) - (n+1)/n
+}
+
+// TopShare is the fraction of the total held by the largest fraction of values, rounding the count up
+func TopShare(values []float64, fraction float64) float64 {
+	sorted := append([]float64{}, values...)
+	sort.Sort(sort.Reverse(sort.Float64Slice(sorted)))
+
+	count := int(math.Ceil(float64(len(sorted)) * fraction))
+	total, top := 0.0, 0.0
+	for i, v := range sorted {
+		total += v
+		if i < count {
+			top += v
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return top / total
+}
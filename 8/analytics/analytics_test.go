@@ -0,0 +1,57 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+)
+
+func TestGini(t *testing.T) {
+	cases := []struct {
+		name   string
+		values []float64
+		gini   float64
+	}{
+		{"none", nil, 0},
+		{"all zero", []float64{0, 0, 0}, 0},
+		{"equal", []float64{5, 5, 5, 5}, 0},
+		{"one has everything", []float64{0, 0, 0, 10}, 0.75},
+		{"unsorted", []float64{3, 1, 2}, 2.0 / 9},
+		{"two", []float64{1, 3}, 0.25},
+	}
+	for _, c := range cases {
+		if gini := Gini(c.values); math.Abs(gini-c.gini) > 1e-9 {
+			t.Errorf("%s: gini of %v is %v, expected %v", c.name, c.values, gini, c.gini)
+		}
+	}
+}
+
+func TestGiniLeavesValuesAlone(t *testing.T) {
+	values := []float64{3, 1, 2}
+	Gini(values)
+	if values[0] != 3 || values[1] != 1 || values[2] != 2 {
+		t.Errorf("values were reordered to %v", values)
+	}
+}
+
+func TestTopShare(t *testing.T) {
+	values := []float64{1, 2, 3, 4, 10}
+	cases := []struct {
+		fraction, share float64
+	}{
+		{0, 0},
+		{0.2, 0.5},
+		{0.3, 0.7}, // 1.5 values rounds up to 2
+		{1, 1},
+	}
+	for _, c := range cases {
+		if share := TopShare(values, c.fraction); math.Abs(share-c.share) > 1e-9 {
+			t.Errorf("top %v of %v hold %v, expected %v", c.fraction, values, share, c.share)
+		}
+	}
+	if share := TopShare(nil, 0.1); share != 0 {
+		t.Errorf("top share of nothing is %v, expected 0", share)
+	}
+	if share := TopShare([]float64{0, 0}, 0.5); share != 0 {
+		t.Errorf("top share of all zeros is %v, expected 0", share)
+	}
+}
@@ -0,0 +1,126 @@
+// Command headless runs a scenario without a display and prints the final prices
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jasonfantl/SimulatedEconomy8/analytics"
+	"github.com/jasonfantl/SimulatedEconomy8/economy"
+)
+
+func main() {
+	scenarioPath := flag.String("scenario", "scenarios/twoCities.json", "scenario file describing the cities and events")
+	ticks := flag.Int("ticks", 0, "number of ticks to run the simulation for, overrides the scenario's ticks when set")
+	seed := flag.Int64("seed", 0, "seed for the random number generators, overrides the scenario's seed when set")
+	csvPath := flag.String("csv", "", "write a snapshot of every city at every tick to this CSV file")
+	columnarPath := flag.String("columnar", "", "write a snapshot of every city at every tick to this columnar file")
+	ledgerPath := flag.String("ledger", "", "write every trade made in every city to this CSV file")
+	loadPath := flag.String("load", "", "resume from a saved simulation instead of building the scenario, the scenario's remaining events still happen if -scenario is given")
+	savePath := flag.String("save", "", "save the simulation to this file once it has finished running")
+	strategies := flag.Bool("strategies", false, "print how well each strategy did in each city, averaged over its agents")
+	flag.Parse()
+
+	setFlags := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = true
+	})
+
+	scenario, err := economy.LoadScenario(*scenarioPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if setFlags["ticks"] {
+		scenario.Ticks = *ticks
+	}
+	if setFlags["seed"] {
+		scenario.Seed = *seed
+	}
+
+	var simulation *economy.Simulation
+	if *loadPath != "" {
+		simulation, err = economy.LoadSimulationFile(*loadPath)
+		if err == nil && setFlags["scenario"] {
+			err = scenario.ScheduleEvents(simulation)
+		}
+	} else {
+		simulation, err = scenario.Build()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	recorder := economy.NewRecorder()
+	analytics.Record(recorder)
+	simulation.OnTick(recorder.Record)
+
+	simulation.Run(scenario.Ticks)
+
+	if *savePath != "" {
+		if err := simulation.SaveFile(*savePath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	if *csvPath != "" {
+		if err := writeFile(*csvPath, recorder.WriteCSV); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if *columnarPath != "" {
+		if err := writeFile(*columnarPath, recorder.WriteColumnar); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	if *ledgerPath != "" {
+		trades := make([]economy.Trade, 0)
+		for _, city := range simulation.Cities() {
+			trades = append(trades, city.Ledger().Trades()...)
+		}
+		err := writeFile(*ledgerPath, func(writer io.Writer) error {
+			return economy.WriteTradesCSV(writer, trades)
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	fmt.Printf("seed %d, prices after %d ticks (min - max expected price)\n", scenario.Seed, simulation.Tick())
+	for _, city := range simulation.Cities() {
+		metrics := analytics.Compute(city)
+		fmt.Printf("%s: %d locals, %d merchants, money gini %.2f, net worth gini %.2f\n",
+			city.Name(), len(city.Locals()), len(city.Merchants()), metrics.MoneyGini, metrics.NetWorthGini)
+		for _, good := range city.Goods() {
+			if priceRange, ok := simulation.LatestPrice(city, good); ok {
+				fmt.Printf("\t%-6s %8.2f - %8.2f\n", good, priceRange.Min, priceRange.Max)
+			}
+		}
+		if *strategies {
+			fmt.Printf("\t%-28s %6s %10s %10s %8s %10s\n", "strategy", "agents", "money", "net worth", "trades", "profit")
+			for _, performance := range city.StrategyReport() {
+				fmt.Printf("\t%-28s %6d %10.2f %10.2f %8d %10.2f\n", performance.Strategy, performance.Agents,
+					performance.MeanMoney, performance.MeanNetWorth, performance.Trades, performance.MeanProfit)
+			}
+		}
+	}
+}
+
+func writeFile(path string, write func(io.Writer) error) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
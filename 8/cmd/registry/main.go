@@ -0,0 +1,42 @@
+// Command registry lets city processes find each other, or lists the cities a running registry knows about
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jasonfantl/SimulatedEconomy8/economy"
+)
+
+func main() {
+	address := flag.String("address", economy.DefaultRegistryAddress, "address the registry listens at, or is asked at with -list")
+	ttl := flag.Duration("ttl", 10*time.Second, "forget cities that haven't advertised for this long")
+	list := flag.Bool("list", false, "print the cities a running registry knows about and who they are connected to, then exit")
+	flag.Parse()
+
+	if *list {
+		peers, err := economy.ListPeers(*address)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, "CITY\tADDRESS\tCONNECTED\tLAST SEEN")
+		for _, peer := range peers {
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s ago\n", peer.City, peer.Address, strings.Join(peer.Connected, ","), time.Since(peer.LastSeen).Round(time.Second))
+		}
+		writer.Flush()
+		return
+	}
+
+	fmt.Printf("registry listening at %s\n", *address)
+	if err := http.ListenAndServe(*address, economy.NewRegistry(*ttl)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,233 @@
+// Package ecology simulates populations that grow, shrink and feed on each other, each described by a differential equation
+package ecology
+
+import (
+	"fmt"
+	"sort"
+)
+
+// The kinds of terms a population's rate of change can be made of
+const (
+	Constant    = "constant"    // rate
+	Linear      = "linear"      // rate * Of
+	Logistic    = "logistic"    // rate * X * (1 - X/Capacity)
+	Interaction = "interaction" // rate * X * With, negative for prey and positive for predators
+)
+
+// Term is one part of how fast a population X changes, the change is the sum of its terms
+type Term struct {
+	Kind     string  `json:"kind"`
+	Rate     float64 `json:"rate"`
+	Of       string  `json:"of,omitempty"`       // linear: the population multiplied, defaults to X
+	With     string  `json:"with,omitempty"`     // interaction: the other population
+	Capacity float64 `json:"capacity,omitempty"` // logistic
+}
+
+// Species is a population and the equation it follows
+type Species struct {
+	Name     string  `json:"name"`
+	Initial  float64 `json:"initial"`
+	Terms    []Term  `json:"terms"`
+	Negative bool    `json:"negative,omitempty"` // let the population go below 0, some abstract models need it
+}
+
+// Config describes an ecosystem. Terms can name populations that aren't species, those only change when they are Set
+type Config struct {
+	Species   []Species `json:"species"`
+	TimeDelta float64   `json:"timeDelta,omitempty"` // model time that passes each Step, defaults to 0.1
+	Substeps  int       `json:"substeps,omitempty"`  // Euler steps taken each Step, defaults to 400
+}
+
+// Validate checks the config makes sense
+func (config Config) Validate() error {
+	names := make(map[string]bool)
+	for _, species := range config.Species {
+		if species.Name == "" {
+			return fmt.Errorf("species has no name")
+		}
+		if names[species.Name] {
+			return fmt.Errorf("species %s is defined twice", species.Name)
+		}
+		names[species.Name] = true
+		for _, term := range species.Terms {
+			switch term.Kind {
+			case Constant, Linear:
+			case Logistic:
+				if term.Capacity <= 0 {
+					return fmt.Errorf("species %s: logistic term needs a positive capacity", species.Name)
+				}
+			case Interaction:
+				if term.With == "" {
+					return fmt.Errorf("species %s: interaction term needs a population to interact with", species.Name)
+				}
+			default:
+				return fmt.Errorf("species %s: unknown term %q", species.Name, term.Kind)
+			}
+		}
+	}
+	if config.TimeDelta < 0 || config.Substeps < 0 {
+		return fmt.Errorf("time delta and substeps can't be negative")
+	}
+	return nil
+}
+
+// Ecosystem holds the current size of every population
+type Ecosystem struct {
+	config      Config
+	populations map[string]float64
+}
+
+// New creates an ecosystem with every species at its initial size
+func New(config Config) (*Ecosystem, error) {
+	populations := make(map[string]float64)
+	for _, species := range config.Species {
+		populations[species.Name] = species.Initial
+	}
+	return Restore(config, populations)
+}
+
+// Restore recreates an ecosystem with the given population sizes
+func Restore(config Config, populations map[string]float64) (*Ecosystem, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if config.TimeDelta == 0 {
+		config.TimeDelta = 0.1
+	}
+	if config.Substeps == 0 {
+		config.Substeps = 400
+	}
+	ecosystem := &Ecosystem{config: config, populations: make(map[string]float64)}
+	for name, size := range populations {
+		ecosystem.populations[name] = size
+	}
+	return ecosystem, nil
+}
+
+// Step moves the ecosystem forward by TimeDelta. Every population changes at once, using the sizes from before the substep
+func (ecosystem *Ecosystem) Step() {
+	dt := ecosystem.config.TimeDelta / float64(ecosystem.config.Substeps)
+	changes := make([]float64, len(ecosystem.config.Species))
+	for i := 0; i < ecosystem.config.Substeps; i++ {
+		for j, species := range ecosystem.config.Species {
+			changes[j] = ecosystem.change(species)
+		}
+		for j, species := range ecosystem.config.Species {
+			size := ecosystem.populations[species.Name] + changes[j]*dt
+			if size < 0 && !species.Negative {
+				size = 0
+			}
+			ecosystem.populations[species.Name] = size
+		}
+	}
+}
+
+func (ecosystem *Ecosystem) change(species Species) float64 {
+	x := ecosystem.populations[species.Name]
+	change := 0.0
+	for _, term := range species.Terms {
+		switch term.Kind {
+		case Constant:
+			change += term.Rate
+		case Linear:
+			of := x
+			if term.Of != "" {
+				of = ecosystem.populations[term.Of]
+			}
+			change += term.Rate * of
+		case Logistic:
+			change += term.Rate * x * (1 - x/term.Capacity)
+		case Interaction:
+			change += term.Rate * x * ecosystem.populations[term.With]
+		}
+	}
+	return change
+}
+
+// Population returns the size of a population, 0 if there is no such population
+func (ecosystem *Ecosystem) Population(name string) float64 {
+	return ecosystem.populations[name]
+}
+
+// Set changes the size of a population, used to drive the ecosystem from outside
+func (ecosystem *Ecosystem) Set(name string, size float64) {
+	ecosystem.populations[name] = size
+}
+
+// Harvest takes up to amount from a population, returning how much was taken
+func (ecosystem *Ecosystem) Harvest(name string, amount float64) float64 {
+	available := ecosystem.populations[name]
+	if amount > available {
+		amount = available
+	}
+	if amount <= 0 {
+		return 0
+	}
+	ecosystem.populations[name] -= amount
+	return amount
+}
+
+// Populations returns the size of every population
+func (ecosystem *Ecosystem) Populations() map[string]float64 {
+	populations := make(map[string]float64)
+	for name, size := range ecosystem.populations {
+		populations[name] = size
+	}
+	return populations
+}
+
+// Names returns the name of every population in alphabetical order
+func (ecosystem *Ecosystem) Names() []string {
+	names := make([]string, 0, len(ecosystem.populations))
+	for name := range ecosystem.populations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Config returns what the ecosystem was created with, with defaults filled in
+func (ecosystem *Ecosystem) Config() Config {
+	return ecosystem.config
+}
+
+// LotkaVolterra is the model of the Population_Economy sketch: grass grows logistically, rabbits eat grass and foxes eat rabbits
+func LotkaVolterra() Config {
+	return Config{
+		Species: []Species{
+			{Name: "foxes", Initial: 150, Terms: []Term{
+				{Kind: Interaction, Rate: 0.003, With: "rabbits"},
+				{Kind: Linear, Rate: -0.1},
+			}},
+			{Name: "rabbits", Initial: 200, Terms: []Term{
+				{Kind: Interaction, Rate: 0.001, With: "grass"},
+				{Kind: Interaction, Rate: -0.003, With: "foxes"},
+			}},
+			{Name: "grass", Initial: 100, Terms: []Term{
+				{Kind: Logistic, Rate: 1.5, Capacity: 1000},
+				{Kind: Interaction, Rate: -0.02, With: "rabbits"},
+			}},
+		},
+	}
+}
+
+// Chaotic is the model of the Chaotic_Population_Economy sketch, a Rössler attractor
+func Chaotic() Config {
+	return Config{
+		Species: []Species{
+			{Name: "foxes", Initial: 20, Negative: true, Terms: []Term{
+				{Kind: Constant, Rate: 0.1},
+				{Kind: Interaction, Rate: 1, With: "grass"},
+				{Kind: Linear, Rate: -14},
+			}},
+			{Name: "rabbits", Initial: -10, Negative: true, Terms: []Term{
+				{Kind: Linear, Rate: 1, Of: "grass"},
+				{Kind: Linear, Rate: 0.1},
+			}},
+			{Name: "grass", Initial: 10.1, Negative: true, Terms: []Term{
+				{Kind: Linear, Rate: -1, Of: "rabbits"},
+				{Kind: Linear, Rate: -1, Of: "foxes"},
+			}},
+		},
+	}
+}
@@ -0,0 +1,121 @@
+package ecology
+
+import (
+	"math"
+	"testing"
+)
+
+func TestStepFollowsLogisticGrowth(t *testing.T) {
+	const rate, capacity, initial = 0.8, 500.0, 10.0
+	ecosystem, err := New(Config{Species: []Species{
+		{Name: "grass", Initial: initial, Terms: []Term{{Kind: Logistic, Rate: rate, Capacity: capacity}}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for step := 1; step <= 100; step++ {
+		ecosystem.Step()
+		time := float64(step) * ecosystem.Config().TimeDelta
+		expected := capacity / (1 + (capacity-initial)/initial*math.Exp(-rate*time))
+		if got := ecosystem.Population("grass"); math.Abs(got-expected) > 1e-3*expected {
+			t.Fatalf("at time %v there is %v grass, expected %v", time, got, expected)
+		}
+	}
+}
+
+func TestStepFollowsLinearTerms(t *testing.T) {
+	// x' = y, y' = -x is a circle: x = cos t, y = -sin t
+	ecosystem, err := New(Config{TimeDelta: 0.5, Substeps: 5000, Species: []Species{
+		{Name: "x", Initial: 1, Negative: true, Terms: []Term{{Kind: Linear, Rate: 1, Of: "y"}}},
+		{Name: "y", Initial: 0, Negative: true, Terms: []Term{{Kind: Linear, Rate: -1, Of: "x"}}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for step := 1; step <= 10; step++ {
+		ecosystem.Step()
+		time := float64(step) * 0.5
+		if x, y := ecosystem.Population("x"), ecosystem.Population("y"); math.Abs(x-math.Cos(time)) > 1e-3 || math.Abs(y+math.Sin(time)) > 1e-3 {
+			t.Fatalf("at time %v got (%v, %v), expected (%v, %v)", time, x, y, math.Cos(time), -math.Sin(time))
+		}
+	}
+}
+
+func TestStepKeepsPredatorPreyCycle(t *testing.T) {
+	// rabbits' = a r - b r f, foxes' = d r f - c f keeps d r - c ln r + b f - a ln f constant
+	const a, b, c, d = 1.0, 0.1, 1.5, 0.075
+	ecosystem, err := New(Config{Species: []Species{
+		{Name: "rabbits", Initial: 10, Terms: []Term{{Kind: Linear, Rate: a}, {Kind: Interaction, Rate: -b, With: "foxes"}}},
+		{Name: "foxes", Initial: 5, Terms: []Term{{Kind: Interaction, Rate: d, With: "rabbits"}, {Kind: Linear, Rate: -c}}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conserved := func() float64 {
+		r, f := ecosystem.Population("rabbits"), ecosystem.Population("foxes")
+		return d*r - c*math.Log(r) + b*f - a*math.Log(f)
+	}
+
+	start := conserved()
+	for step := 0; step < 200; step++ {
+		ecosystem.Step()
+	}
+	if drift := math.Abs(conserved() - start); drift > 1e-2*math.Abs(start) {
+		t.Errorf("the cycle drifted by %v from %v", drift, start)
+	}
+}
+
+func TestStepStopsAtZero(t *testing.T) {
+	ecosystem, err := New(Config{Species: []Species{
+		{Name: "grass", Initial: 1, Terms: []Term{{Kind: Constant, Rate: -100}}},
+		{Name: "debt", Initial: 1, Negative: true, Terms: []Term{{Kind: Constant, Rate: -100}}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecosystem.Step()
+	if grass := ecosystem.Population("grass"); grass != 0 {
+		t.Errorf("grass went to %v, populations can't go below 0", grass)
+	}
+	if debt := ecosystem.Population("debt"); math.Abs(debt-(1-100*0.1)) > 1e-9 {
+		t.Errorf("debt is %v, expected it to go below 0", debt)
+	}
+}
+
+func TestHarvest(t *testing.T) {
+	ecosystem, err := New(LotkaVolterra())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if taken := ecosystem.Harvest("grass", 30); taken != 30 || ecosystem.Population("grass") != 70 {
+		t.Errorf("took %v leaving %v, expected 30 leaving 70", taken, ecosystem.Population("grass"))
+	}
+	if taken := ecosystem.Harvest("grass", 1000); taken != 70 || ecosystem.Population("grass") != 0 {
+		t.Errorf("took %v leaving %v, expected what was left", taken, ecosystem.Population("grass"))
+	}
+	if taken := ecosystem.Harvest("rabbits", -5); taken != 0 {
+		t.Errorf("harvested %v, a negative amount shouldn't take anything", taken)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := LotkaVolterra().Validate(); err != nil {
+		t.Error(err)
+	}
+	if err := Chaotic().Validate(); err != nil {
+		t.Error(err)
+	}
+	for name, config := range map[string]Config{
+		"unnamed":           {Species: []Species{{}}},
+		"twice":             {Species: []Species{{Name: "a"}, {Name: "a"}}},
+		"no capacity":       {Species: []Species{{Name: "a", Terms: []Term{{Kind: Logistic, Rate: 1}}}}},
+		"no interaction":    {Species: []Species{{Name: "a", Terms: []Term{{Kind: Interaction, Rate: 1}}}}},
+		"unknown term":      {Species: []Species{{Name: "a", Terms: []Term{{Kind: "quadratic"}}}}},
+		"negative substeps": {Substeps: -1},
+	} {
+		if err := config.Validate(); err == nil {
+			t.Errorf("%s: config should be invalid", name)
+		}
+	}
+}
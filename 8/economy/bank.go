@@ -0,0 +1,310 @@
+package economy
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// BankPolicy decides how a city's bank takes deposits and lends. Rates are per tick
+type BankPolicy struct {
+	Capital      float64 `json:"capital"`                // money the bank starts with
+	LoanRate     float64 `json:"loanRate"`               // interest charged on loans
+	DepositRate  float64 `json:"depositRate,omitempty"`  // interest paid on deposits
+	ReserveRatio float64 `json:"reserveRatio,omitempty"` // fraction of deposits the bank keeps on hand, it won't lend below this
+	CreditLimit  float64 `json:"creditLimit"`            // the most one agent can owe
+	DepositAbove float64 `json:"depositAbove,omitempty"` // at the end of every tick locals deposit money above this, 0 never deposits
+	RepayAbove   float64 `json:"repayAbove,omitempty"`   // at the end of every tick borrowers repay with money above this
+	DefaultAfter int     `json:"defaultAfter,omitempty"` // ticks a borrower can go without covering their interest before they default, 0 never
+}
+
+// Validate checks the policy makes sense
+func (policy BankPolicy) Validate() error {
+	if policy.Capital < 0 || policy.CreditLimit < 0 {
+		return fmt.Errorf("bank capital and credit limit can't be negative")
+	}
+	if policy.LoanRate < 0 || policy.DepositRate < 0 {
+		return fmt.Errorf("bank interest rates can't be negative")
+	}
+	if policy.ReserveRatio < 0 || policy.ReserveRatio > 1 {
+		return fmt.Errorf("reserve ratio must be between 0 and 1")
+	}
+	if policy.DefaultAfter < 0 {
+		return fmt.Errorf("default after can't be negative")
+	}
+	return nil
+}
+
+// BankReport is what a bank did during a tick and where it stands at the end of it
+type BankReport struct {
+	Lent, Repaid                 float64 // new loans and repayments
+	InterestEarned, InterestPaid float64 // on loans and deposits
+	Defaults                     int     // borrowers who defaulted
+	WrittenOff                   float64 // debt that will never be repaid
+	Reserves, Deposits, Loans    float64 // at the end of the tick
+}
+
+type loan struct {
+	Owed     float64 `json:"owed"`
+	LastPaid int     `json:"lastPaid"` // the tick the loan was taken out or its interest last covered
+}
+
+// Bank takes deposits from locals and lends to anyone in the city who wants to buy something they can't afford
+type Bank struct {
+	policy    BankPolicy
+	reserves  float64
+	deposits  map[AgentID]float64
+	deposited float64 // the sum of deposits, kept as they change so lending doesn't have to add them up
+	loans     map[AgentID]*loan
+	defaulted map[AgentID]int // when each borrower last defaulted, they can't borrow for DefaultAfter ticks
+
+	report, lastReport BankReport
+}
+
+func newBank(policy BankPolicy) *Bank {
+	return &Bank{
+		policy:    policy,
+		reserves:  policy.Capital,
+		deposits:  make(map[AgentID]float64),
+		loans:     make(map[AgentID]*loan),
+		defaulted: make(map[AgentID]int),
+	}
+}
+
+// SetBankPolicy opens a bank in the city with the policy, or changes the policy of the bank already there
+func (city *City) SetBankPolicy(policy BankPolicy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	if city.bank == nil {
+		city.bank = newBank(policy)
+		return nil
+	}
+	city.bank.policy = policy
+	return nil
+}
+
+// Bank returns the city's bank, nil if it doesn't have one
+func (city *City) Bank() *Bank {
+	return city.bank
+}
+
+// Policy returns the bank's policy
+func (bank *Bank) Policy() BankPolicy {
+	return bank.policy
+}
+
+// Report returns what the bank did during the last tick
+func (bank *Bank) Report() BankReport {
+	return bank.lastReport
+}
+
+// Deposit returns how much an agent has deposited
+func (bank *Bank) Deposit(id AgentID) float64 {
+	return bank.deposits[id]
+}
+
+// Owed returns how much an agent owes
+func (bank *Bank) Owed(id AgentID) float64 {
+	if loan, ok := bank.loans[id]; ok {
+		return loan.Owed
+	}
+	return 0
+}
+
+func (bank *Bank) totalDeposits() float64 {
+	return bank.deposited
+}
+
+// adds to what an agent has deposited, a negative amount takes it out. An emptied deposit is closed
+func (bank *Bank) changeDeposit(id AgentID, amount float64) {
+	bank.deposits[id] += amount
+	bank.deposited += amount
+	if bank.deposits[id] <= 0 {
+		bank.deposited -= bank.deposits[id]
+		delete(bank.deposits, id)
+	}
+}
+
+func (bank *Bank) totalLoans() float64 {
+	total := 0.0
+	for _, id := range sortedAgentIDs(bank.loans) {
+		total += bank.loans[id].Owed
+	}
+	return total
+}
+
+// how much more the bank would lend the agent
+func (city *City) creditAvailable(agent EconomicAgent) float64 {
+	bank := city.bank
+	if bank == nil {
+		return 0
+	}
+	if when, ok := bank.defaulted[agent.id()]; ok && city.tick-when < bank.policy.DefaultAfter {
+		return 0
+	}
+	lendable := bank.reserves - bank.policy.ReserveRatio*bank.totalDeposits()
+	return math.Max(math.Min(bank.policy.CreditLimit-bank.Owed(agent.id()), lendable), 0)
+}
+
+// spendingPower is what the agent could pay right now: their money, their deposits and whatever the bank would lend them
+func (city *City) spendingPower(agent EconomicAgent) float64 {
+	if city.bank == nil {
+		return agent.balance()
+	}
+	withdrawable := math.Min(city.bank.deposits[agent.id()], city.bank.reserves)
+	return agent.balance() + withdrawable + city.creditAvailable(agent)
+}
+
+// makes sure the agent has at least amount, first from their deposits and then by borrowing
+func (city *City) fund(agent EconomicAgent, amount float64) {
+	bank := city.bank
+	shortfall := amount - agent.balance()
+	if bank == nil || shortfall <= 0 {
+		return
+	}
+
+	if withdrawal := math.Min(math.Min(bank.deposits[agent.id()], bank.reserves), shortfall); withdrawal > 0 {
+		bank.changeDeposit(agent.id(), -withdrawal)
+		bank.reserves -= withdrawal
+		agent.addMoney(withdrawal)
+		shortfall -= withdrawal
+	}
+
+	if borrowed := math.Min(city.creditAvailable(agent), shortfall); borrowed > 0 {
+		if _, ok := bank.loans[agent.id()]; !ok {
+			bank.loans[agent.id()] = &loan{LastPaid: city.tick}
+		}
+		bank.loans[agent.id()].Owed += borrowed
+		bank.reserves -= borrowed
+		bank.report.Lent += borrowed
+		agent.addMoney(borrowed)
+	}
+
+	city.syncAccount(agent)
+}
+
+// charges and pays interest, collects repayments, handles defaults and takes deposits. Called at the end of every tick
+func (city *City) settleBank() {
+	bank := city.bank
+	if bank == nil {
+		return
+	}
+
+	present := make(map[AgentID]EconomicAgent)
+	for _, agent := range city.allEconomicAgents() {
+		present[agent.id()] = agent
+	}
+
+	for _, id := range sortedAgentIDs(bank.deposits) {
+		interest := bank.deposits[id] * bank.policy.DepositRate
+		bank.changeDeposit(id, interest)
+		bank.report.InterestPaid += interest
+	}
+
+	for _, id := range sortedAgentIDs(bank.loans) {
+		loan := bank.loans[id]
+		interest := loan.Owed * bank.policy.LoanRate
+		loan.Owed += interest
+		bank.report.InterestEarned += interest
+
+		agent, here := present[id]
+		if here {
+			if repayment := math.Min(loan.Owed, agent.balance()-bank.policy.RepayAbove); repayment > 0 {
+				agent.addMoney(-repayment)
+				bank.reserves += repayment
+				bank.report.Repaid += repayment
+				loan.Owed -= repayment
+				if repayment >= interest { // paying less than the interest only delays default
+					loan.LastPaid = city.tick
+				}
+			}
+		}
+
+		if loan.Owed <= 1e-9 {
+			delete(bank.loans, id)
+		} else if bank.policy.DefaultAfter > 0 && city.tick-loan.LastPaid > bank.policy.DefaultAfter {
+			// take what we can, the rest is lost
+			if here {
+				seized := math.Min(math.Max(agent.balance(), 0), loan.Owed)
+				agent.addMoney(-seized)
+				loan.Owed -= seized
+				bank.reserves += seized
+				bank.report.Repaid += seized
+			}
+			if deposit := math.Min(bank.deposits[id], loan.Owed); deposit > 0 {
+				bank.changeDeposit(id, -deposit)
+				loan.Owed -= deposit
+			}
+			bank.report.WrittenOff += loan.Owed
+			bank.report.Defaults++
+			bank.defaulted[id] = city.tick
+			delete(bank.loans, id)
+		}
+	}
+
+	if bank.policy.DepositAbove > 0 {
+		for _, local := range city.locals {
+			if excess := local.money - bank.policy.DepositAbove; excess > 0 {
+				local.money -= excess
+				bank.changeDeposit(local.ID, excess)
+				bank.reserves += excess
+			}
+		}
+	}
+
+	for _, agent := range city.allEconomicAgents() {
+		city.syncAccount(agent)
+	}
+
+	bank.report.Reserves = bank.reserves
+	bank.report.Deposits = bank.totalDeposits()
+	bank.report.Loans = bank.totalLoans()
+	bank.lastReport = bank.report
+	bank.report = BankReport{}
+}
+
+// the agent is gone for good, so what they have repays their loan and the bank writes off the rest straight away
+// instead of charging interest on it forever. Returns what they have left
+func (city *City) closeLoan(id AgentID, money float64) float64 {
+	bank := city.bank
+	if bank == nil {
+		return money
+	}
+	loan, ok := bank.loans[id]
+	if !ok {
+		return money
+	}
+	repayment := math.Min(math.Max(money, 0), loan.Owed)
+	loan.Owed -= repayment
+	bank.reserves += repayment
+	bank.report.Repaid += repayment
+	if loan.Owed > 1e-9 {
+		bank.report.WrittenOff += loan.Owed
+		bank.report.Defaults++
+	}
+	delete(bank.loans, id)
+	return money - repayment
+}
+
+// tells the agent what they owe, have saved and could borrow. Merchants are told when they arrive, the bank may have written their debt off while they were away
+func (city *City) syncAccount(agent EconomicAgent) {
+	if city.bank == nil {
+		return
+	}
+	agent.setDebt(city.name, city.bank.Owed(agent.id()))
+	if local, ok := agent.(*Local); ok {
+		local.savings = city.bank.deposits[local.ID]
+		local.credit = city.creditAvailable(local)
+	}
+}
+
+// map iteration order is random, sums have to be taken in the same order every time to be reproducible
+func sortedAgentIDs[V any](values map[AgentID]V) []AgentID {
+	ids := make([]AgentID, 0, len(values))
+	for id := range values {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
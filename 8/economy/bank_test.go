@@ -0,0 +1,34 @@
+package economy
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDepositTotalKeepsUp(t *testing.T) {
+	_, simulation := buildScenario(t, "credit")
+	for _, city := range simulation.cities {
+		policy := BankPolicy{Capital: 1000, LoanRate: 0.01, DepositRate: 0.005, ReserveRatio: 0.2, CreditLimit: 200, DepositAbove: 30, DefaultAfter: 20}
+		if err := city.SetBankPolicy(policy); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deposited := false
+	for i := 0; i < 200; i++ {
+		simulation.Step()
+		for _, city := range simulation.cities {
+			sum := 0.0
+			for _, deposit := range city.bank.deposits {
+				sum += deposit
+			}
+			if math.Abs(sum-city.bank.totalDeposits()) > 1e-6 {
+				t.Fatalf("tick %d, %s: deposits add up to %.6f but the bank counts %.6f", simulation.tick, city.name, sum, city.bank.totalDeposits())
+			}
+			deposited = deposited || sum > 0
+		}
+	}
+	if !deposited {
+		t.Error("nobody ever deposited anything")
+	}
+}
@@ -0,0 +1,246 @@
+package economy
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// BeliefRule decides how an agent's expected price for a good changes as they trade and hear from others.
+// Each market gets its own rule, so rules can keep state. Every method returns the new expected price,
+// volatility is how far the agent is willing to move their belief in one step
+type BeliefRule interface {
+	Name() string
+	// Traded is called after the agent bought or sold one unit at price
+	Traded(expected, volatility float64, buying bool, price float64) float64
+	// Heard is called after someone told the agent what they expect the price to be
+	Heard(expected, volatility, heard float64) float64
+	// Stale is called when the agent has gone too long without trading, buying is whether they were trying to buy
+	Stale(expected, volatility float64, buying bool) float64
+}
+
+// the built in belief rules
+const (
+	NudgeBeliefsName    = "nudge"
+	SmoothedBeliefsName = "smoothing"
+	BayesianBeliefsName = "bayesian"
+	KalmanBeliefsName   = "kalman"
+)
+
+var beliefRules = map[string]func() BeliefRule{
+	NudgeBeliefsName:    func() BeliefRule { return &NudgeBeliefs{} },
+	SmoothedBeliefsName: func() BeliefRule { return &SmoothedBeliefs{Alpha: 0.1} },
+	BayesianBeliefsName: func() BeliefRule { return &BayesianBeliefs{} },
+	KalmanBeliefsName:   func() BeliefRule { return &KalmanBeliefs{} },
+}
+
+// RegisterBeliefRule makes a belief rule available by name, create must return a new rule every time
+func RegisterBeliefRule(name string, create func() BeliefRule) {
+	beliefRules[name] = create
+}
+
+// NewBeliefRule creates a belief rule from its name
+func NewBeliefRule(name string) (BeliefRule, error) {
+	create, ok := beliefRules[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown belief rule %q", name)
+	}
+	return create(), nil
+}
+
+// BeliefRules returns the names of every registered belief rule
+func BeliefRules() []string {
+	names := make([]string, 0, len(beliefRules))
+	for name := range beliefRules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NudgeBeliefs is how the tutorial's locals think: every event moves the belief one step up or down
+type NudgeBeliefs struct{}
+
+// Name implements BeliefRule
+func (beliefs *NudgeBeliefs) Name() string {
+	return NudgeBeliefsName
+}
+
+// Traded implements BeliefRule, if we could buy it we probably overpaid, if we could sell it we probably undercharged
+func (beliefs *NudgeBeliefs) Traded(expected, volatility float64, buying bool, price float64) float64 {
+	if buying {
+		return expected - volatility
+	}
+	return expected + volatility
+}
+
+// Heard implements BeliefRule
+func (beliefs *NudgeBeliefs) Heard(expected, volatility, heard float64) float64 {
+	if heard > expected {
+		return expected + volatility
+	} else if heard < expected {
+		return expected - volatility
+	}
+	return expected
+}
+
+// Stale implements BeliefRule, buyers need to be willing to pay more and sellers to sell for less
+func (beliefs *NudgeBeliefs) Stale(expected, volatility float64, buying bool) float64 {
+	if buying {
+		return expected + volatility
+	}
+	return expected - volatility
+}
+
+// SmoothedBeliefs moves the belief a fraction of the way towards every price seen, then nudges it like NudgeBeliefs after a trade
+type SmoothedBeliefs struct {
+	Alpha float64 `json:"alpha"` // how much of the way to move, between 0 and 1
+}
+
+// Name implements BeliefRule
+func (beliefs *SmoothedBeliefs) Name() string {
+	return SmoothedBeliefsName
+}
+
+// Traded implements BeliefRule
+func (beliefs *SmoothedBeliefs) Traded(expected, volatility float64, buying bool, price float64) float64 {
+	expected += beliefs.Alpha * (price - expected)
+	return (&NudgeBeliefs{}).Traded(expected, volatility, buying, price)
+}
+
+// Heard implements BeliefRule
+func (beliefs *SmoothedBeliefs) Heard(expected, volatility, heard float64) float64 {
+	return expected + beliefs.Alpha*(heard-expected)
+}
+
+// Stale implements BeliefRule
+func (beliefs *SmoothedBeliefs) Stale(expected, volatility float64, buying bool) float64 {
+	return (&NudgeBeliefs{}).Stale(expected, volatility, buying)
+}
+
+// BayesianBeliefs treats the price as an unknown constant with a normal prior, every price seen is a noisy observation of it.
+// The more it sees the surer it gets and the less each observation moves it, going a while without trading makes it less sure.
+// Zero variances are set from the volatility the first time they are needed
+type BayesianBeliefs struct {
+	Variance         float64 `json:"variance"`         // how unsure we are of the price
+	ObservationNoise float64 `json:"observationNoise"` // variance of each observed price around the true price
+}
+
+// Name implements BeliefRule
+func (beliefs *BayesianBeliefs) Name() string {
+	return BayesianBeliefsName
+}
+
+func (beliefs *BayesianBeliefs) initialize(volatility float64) {
+	if beliefs.Variance == 0 {
+		beliefs.Variance = 100 * volatility * volatility
+	}
+	if beliefs.ObservationNoise == 0 {
+		beliefs.ObservationNoise = 25 * volatility * volatility
+	}
+}
+
+// moves the belief towards the observation, weighted by how sure we are of each
+func (beliefs *BayesianBeliefs) observe(expected, observation float64) float64 {
+	total := beliefs.Variance + beliefs.ObservationNoise
+	if total <= 0 {
+		return expected
+	}
+	gain := beliefs.Variance / total
+	beliefs.Variance = beliefs.Variance * beliefs.ObservationNoise / total
+	return expected + gain*(observation-expected)
+}
+
+// Traded implements BeliefRule
+func (beliefs *BayesianBeliefs) Traded(expected, volatility float64, buying bool, price float64) float64 {
+	beliefs.initialize(volatility)
+	expected = beliefs.observe(expected, price)
+	return (&NudgeBeliefs{}).Traded(expected, volatility, buying, price)
+}
+
+// Heard implements BeliefRule
+func (beliefs *BayesianBeliefs) Heard(expected, volatility, heard float64) float64 {
+	beliefs.initialize(volatility)
+	return beliefs.observe(expected, heard)
+}
+
+// Stale implements BeliefRule
+func (beliefs *BayesianBeliefs) Stale(expected, volatility float64, buying bool) float64 {
+	beliefs.initialize(volatility)
+	beliefs.Variance += volatility * volatility
+	return (&NudgeBeliefs{}).Stale(expected, volatility, buying)
+}
+
+// KalmanBeliefs treats the price as a random walk, so unlike BayesianBeliefs it never becomes completely sure of it
+type KalmanBeliefs struct {
+	BayesianBeliefs
+	ProcessNoise float64 `json:"processNoise"` // how much the true price is expected to move between observations
+}
+
+// Name implements BeliefRule
+func (beliefs *KalmanBeliefs) Name() string {
+	return KalmanBeliefsName
+}
+
+// the price may have moved since we last looked
+func (beliefs *KalmanBeliefs) predict(volatility float64) {
+	beliefs.initialize(volatility)
+	if beliefs.ProcessNoise == 0 {
+		beliefs.ProcessNoise = volatility * volatility
+	}
+	beliefs.Variance += beliefs.ProcessNoise
+}
+
+// Traded implements BeliefRule
+func (beliefs *KalmanBeliefs) Traded(expected, volatility float64, buying bool, price float64) float64 {
+	beliefs.predict(volatility)
+	expected = beliefs.observe(expected, price)
+	return (&NudgeBeliefs{}).Traded(expected, volatility, buying, price)
+}
+
+// Heard implements BeliefRule
+func (beliefs *KalmanBeliefs) Heard(expected, volatility, heard float64) float64 {
+	beliefs.predict(volatility)
+	return beliefs.observe(expected, heard)
+}
+
+// Stale implements BeliefRule
+func (beliefs *KalmanBeliefs) Stale(expected, volatility float64, buying bool) float64 {
+	beliefs.predict(volatility)
+	return (&NudgeBeliefs{}).Stale(expected, volatility, buying)
+}
+
+// savedBelief lets a belief rule be saved and restored along with its state
+type savedBelief struct {
+	Rule BeliefRule
+}
+
+func (saved savedBelief) MarshalJSON() ([]byte, error) {
+	state, err := json.Marshal(saved.Rule)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(struct {
+		Name  string          `json:"name"`
+		State json.RawMessage `json:"state"`
+	}{saved.Rule.Name(), state})
+}
+
+func (saved *savedBelief) UnmarshalJSON(data []byte) error {
+	named := struct {
+		Name  string          `json:"name"`
+		State json.RawMessage `json:"state"`
+	}{}
+	if err := json.Unmarshal(data, &named); err != nil {
+		return err
+	}
+	rule, err := NewBeliefRule(named.Name)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(named.State, rule); err != nil {
+		return fmt.Errorf("belief rule %s: %w", named.Name, err)
+	}
+	saved.Rule = rule
+	return nil
+}
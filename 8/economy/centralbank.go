@@ -0,0 +1,258 @@
+package economy
+
+import (
+	"fmt"
+	"math"
+)
+
+// The rules a central bank can follow
+const (
+	MonetaryNone      = "none"        // only measure prices
+	MonetaryGrowth    = "fixedGrowth" // grow the money supply by GrowthRate every time
+	MonetaryTaylor    = "taylor"      // grow or shrink the money supply to bring inflation to TargetInflation
+	MonetaryTransfers = "transfers"   // give Amount to every local with less money than Below
+)
+
+// MonetaryPolicy decides how a city's central bank measures prices and changes the money supply.
+// Prices are what goods last traded for in the city. New money is split equally between the locals,
+// money is destroyed in proportion to what each local has
+type MonetaryPolicy struct {
+	Rule   string           `json:"rule"`
+	Basket map[Good]float64 `json:"basket,omitempty"` // units of each good the price index is made of, defaults to one of every good
+	Every  int              `json:"every,omitempty"`  // ticks between actions, inflation is measured over this period. Defaults to 1
+
+	GrowthRate float64 `json:"growthRate,omitempty"` // fixedGrowth: fraction of the money supply created, negative destroys
+
+	TargetInflation float64 `json:"targetInflation,omitempty"` // taylor: wanted inflation per period
+	Response        float64 `json:"response,omitempty"`        // taylor: money growth per unit of inflation below target
+	MaxGrowth       float64 `json:"maxGrowth,omitempty"`       // taylor: limits money growth in either direction, 0 is no limit
+	SetLoanRate     bool    `json:"setLoanRate,omitempty"`     // taylor: also set the loan rate of the city's bank, replacing the one in its bank policy
+	NeutralRate     float64 `json:"neutralRate,omitempty"`     // taylor: the loan rate when inflation is on target, only used with setLoanRate
+	RateResponse    float64 `json:"rateResponse,omitempty"`    // taylor: loan rate rise per unit of inflation above target, only used with setLoanRate
+
+	Amount float64 `json:"amount,omitempty"` // transfers
+	Below  float64 `json:"below,omitempty"`  // transfers
+}
+
+// Validate checks the policy makes sense with the goods of the catalog
+func (policy MonetaryPolicy) Validate(catalog *Catalog) error {
+	switch policy.Rule {
+	case "", MonetaryNone, MonetaryGrowth, MonetaryTaylor, MonetaryTransfers:
+	default:
+		return fmt.Errorf("unknown monetary rule %q", policy.Rule)
+	}
+	if policy.Every < 0 {
+		return fmt.Errorf("every can't be negative")
+	}
+	for good, units := range policy.Basket {
+		if !catalog.tradable(good) {
+			return fmt.Errorf("basket has unknown good %s", good)
+		}
+		if units < 0 {
+			return fmt.Errorf("basket can't have negative %s", good)
+		}
+	}
+	if policy.GrowthRate < -1 {
+		return fmt.Errorf("can't destroy more than all the money")
+	}
+	if policy.MaxGrowth < 0 {
+		return fmt.Errorf("max growth can't be negative")
+	}
+	if policy.NeutralRate < 0 || policy.RateResponse < 0 {
+		return fmt.Errorf("neutral rate and rate response can't be negative")
+	}
+	return nil
+}
+
+// MonetaryReport is what a central bank measured and did during a tick
+type MonetaryReport struct {
+	PriceIndex float64 // cost of the basket, 100 when it could first be priced. Stays at 100 until every good in it has traded
+	Inflation  float64 // change in the price index since the central bank last acted
+	Created    float64 // money created this tick, negative if destroyed
+}
+
+// CentralBank measures prices in a city and controls how much money there is
+type CentralBank struct {
+	policy MonetaryPolicy
+
+	baseCost      float64          // cost of the basket when it could first be priced
+	prices        map[Good]float64 // the mean price each good traded for on the last tick it traded
+	lastIndex     float64          // price index when the central bank last acted
+	totalCreated  float64
+	report        MonetaryReport
+	nextActionDue int // the tick the central bank acts next
+}
+
+// SetMonetaryPolicy opens a central bank in the city with the policy, or changes the policy of the one there.
+// The price index starts at 100 when the central bank opens
+func (city *City) SetMonetaryPolicy(policy MonetaryPolicy) error {
+	if err := policy.Validate(city.catalog); err != nil {
+		return err
+	}
+	if city.centralBank == nil {
+		city.centralBank = &CentralBank{nextActionDue: city.tick, prices: make(map[Good]float64)}
+	}
+	city.centralBank.policy = policy
+	city.centralBank.baseCost = 0 // the index restarts with the new basket
+	return nil
+}
+
+// CentralBank returns the city's central bank, nil if it doesn't have one
+func (city *City) CentralBank() *CentralBank {
+	return city.centralBank
+}
+
+// Policy returns the central bank's policy
+func (centralBank *CentralBank) Policy() MonetaryPolicy {
+	return centralBank.policy
+}
+
+// Report returns what the central bank measured and did during the last tick
+func (centralBank *CentralBank) Report() MonetaryReport {
+	return centralBank.report
+}
+
+// TotalCreated returns all the money the central bank has created, minus what it destroyed
+func (centralBank *CentralBank) TotalCreated() float64 {
+	return centralBank.totalCreated
+}
+
+func (policy MonetaryPolicy) basket(catalog *Catalog) map[Good]float64 {
+	if len(policy.Basket) > 0 {
+		return policy.Basket
+	}
+	basket := make(map[Good]float64)
+	for _, good := range catalog.goods {
+		basket[good] = 1
+	}
+	return basket
+}
+
+// remembers what every good traded for during the tick, goods that didn't trade keep their last price
+func (centralBank *CentralBank) observePrices(city *City) {
+	for good, tally := range city.trades {
+		if tally.Count > 0 {
+			centralBank.prices[good] = tally.Value / float64(tally.Count)
+		}
+	}
+}
+
+// what a basket of goods cost at the prices they last traded for, false if some good in it hasn't traded yet
+func (centralBank *CentralBank) basketCost(catalog *Catalog, basket map[Good]float64) (float64, bool) {
+	cost := 0.0
+	for _, good := range catalog.goods { // a fixed order keeps the sum reproducible
+		if units, ok := basket[good]; ok && units > 0 {
+			price, traded := centralBank.prices[good]
+			if !traded {
+				return 0, false
+			}
+			cost += units * price
+		}
+	}
+	return cost, true
+}
+
+// MoneySupply is the money held by everyone in the city, including bank deposits
+func (city *City) MoneySupply() float64 {
+	supply := 0.0
+	for _, agent := range city.allEconomicAgents() {
+		supply += agent.balance()
+	}
+	if city.bank != nil {
+		supply += city.bank.totalDeposits()
+	}
+	return supply
+}
+
+// measures prices and acts on the policy if it is time to. Called at the end of every tick
+func (city *City) runCentralBank() {
+	centralBank := city.centralBank
+	if centralBank == nil {
+		return
+	}
+	policy := centralBank.policy
+
+	centralBank.observePrices(city)
+	cost, priced := centralBank.basketCost(city.catalog, policy.basket(city.catalog))
+	if centralBank.baseCost == 0 && priced {
+		centralBank.baseCost = cost
+		centralBank.lastIndex = 100
+	}
+	index := 100.0
+	if centralBank.baseCost != 0 && priced {
+		index = 100 * cost / centralBank.baseCost
+	}
+	centralBank.report = MonetaryReport{PriceIndex: index}
+	if centralBank.lastIndex != 0 {
+		centralBank.report.Inflation = index/centralBank.lastIndex - 1
+	}
+
+	if city.tick < centralBank.nextActionDue {
+		return
+	}
+	every := policy.Every
+	if every <= 0 {
+		every = 1
+	}
+	centralBank.nextActionDue = city.tick + every
+	inflation := centralBank.report.Inflation
+	centralBank.lastIndex = index
+
+	switch policy.Rule {
+	case MonetaryGrowth:
+		centralBank.report.Created = city.changeMoneySupply(policy.GrowthRate * city.localMoney())
+	case MonetaryTaylor:
+		growth := policy.Response * (policy.TargetInflation - inflation)
+		if policy.MaxGrowth > 0 {
+			growth = math.Max(math.Min(growth, policy.MaxGrowth), -policy.MaxGrowth)
+		}
+		centralBank.report.Created = city.changeMoneySupply(growth * city.localMoney())
+		if policy.SetLoanRate && city.bank != nil {
+			city.bank.policy.LoanRate = math.Max(policy.NeutralRate+policy.RateResponse*(inflation-policy.TargetInflation), 0)
+		}
+	case MonetaryTransfers:
+		for _, local := range city.locals {
+			if local.money < policy.Below {
+				local.money += policy.Amount
+				centralBank.report.Created += policy.Amount
+			}
+		}
+	}
+	centralBank.totalCreated += centralBank.report.Created
+}
+
+func (city *City) localMoney() float64 {
+	money := 0.0
+	for _, local := range city.locals {
+		money += local.money
+	}
+	return money
+}
+
+// creates (or with a negative amount destroys) money held by the locals, returning how much actually changed.
+// Money is only taken from locals who have some and never more than they have, locals in the red lose nothing
+func (city *City) changeMoneySupply(amount float64) float64 {
+	if len(city.locals) == 0 || amount == 0 {
+		return 0
+	}
+	if amount > 0 {
+		city.GrantMoney(amount / float64(len(city.locals)))
+		return amount
+	}
+
+	held := 0.0
+	for _, local := range city.locals {
+		held += math.Max(local.money, 0)
+	}
+	if held <= 0 {
+		return 0
+	}
+	fraction := math.Min(-amount/held, 1)
+	destroyed := 0.0
+	for _, local := range city.locals {
+		taken := math.Min(math.Max(local.money, 0)*fraction, math.Max(local.money, 0))
+		local.money -= taken
+		destroyed += taken
+	}
+	return -destroyed
+}
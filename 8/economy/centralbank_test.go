@@ -0,0 +1,41 @@
+package economy
+
+import (
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestContractionOnlyTakesWhatLocalsHave(t *testing.T) {
+	city := NewCity("First", color.White, 4, 1)
+	for i, money := range []float64{100, 50, -80, 0} {
+		city.locals[i].money = money
+	}
+
+	destroyed := city.changeMoneySupply(-300)
+	if math.Abs(destroyed+150) > 1e-9 {
+		t.Errorf("expected 150 to be destroyed, got %.2f", -destroyed)
+	}
+	for i, want := range []float64{0, 0, -80, 0} {
+		if math.Abs(city.locals[i].money-want) > 1e-9 {
+			t.Errorf("local %d has %.2f, expected %.2f", i, city.locals[i].money, want)
+		}
+	}
+}
+
+func TestTaylorRuleSetsTheLoanRateWithItsOwnResponse(t *testing.T) {
+	city := NewCity("First", color.White, 10, 1)
+	if err := city.SetBankPolicy(BankPolicy{Capital: 100, LoanRate: 0.5}); err != nil {
+		t.Fatal(err)
+	}
+	policy := MonetaryPolicy{Rule: MonetaryTaylor, Response: 100, SetLoanRate: true, NeutralRate: 0.01, RateResponse: 0.5}
+	if err := city.SetMonetaryPolicy(policy); err != nil {
+		t.Fatal(err)
+	}
+	city.centralBank.lastIndex = 100 / 1.02 // nothing has traded so the index stays at 100, prices rose 2% since last time
+	city.runCentralBank()
+
+	if rate := city.bank.policy.LoanRate; math.Abs(rate-0.02) > 1e-9 {
+		t.Errorf("expected a loan rate of 0.02, got %v", rate)
+	}
+}
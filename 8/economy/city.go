@@ -1,102 +1,371 @@
 package economy
 
 import (
+	"fmt"
 	"image/color"
+	"math/rand"
+
+	"github.com/jasonfantl/SimulatedEconomy8/ecology"
 )
 
 // EconomicAgent is an interface that requires the minimum methods to interact in the economy
 type EconomicAgent interface {
 	isSelling(Good) (bool, float64)
+	isBuying(*City, Good) (bool, float64) // the most the agent would pay right now, before checking what they can spend
 	transact(Good, bool, float64)
-	gossip(Good) float64
+	gossip(Good) (float64, bool) // what the agent believes a good sells for, false if they have no belief about it
+	id() AgentID
+	kind() AgentKind
+	balance() float64
+	addMoney(float64)
+	strategy() string // groups agents that behave the same in reports
+	holding(Good) int // how many of a good the agent has
+	setDebt(cityName, float64)
 }
 
 type cityName string
 
 // City separates economies from each other and manages all of its residents
 type City struct {
-	name  cityName
-	color color.Color
+	name    cityName
+	color   color.Color
+	catalog *Catalog // the goods traded and the recipes used, shared by every city of a simulation
+
+	// kept as slices so residents are always visited in the same order
+	locals    []*Local
+	merchants []*Merchant
+	traders   []*Trader
+	firms     []*Firm
+
+	// every random decision made in the city comes from here, so a seed reproduces a run
+	rng    *rand.Rand
+	source *savableSource
+
+	tick   int                  // how many times Update has been called
+	round  int                  // how many times everyone has been updated, counting every update inside a tick
+	nextID int                  // for giving residents unique ids
+	trades map[Good]*tradeTally // trades made during the current tick
+	ledger *Ledger
+	market MarketMechanism // how buyers find sellers
+
+	leisureTaken, lastLeisureTaken int // how many times locals chose to do nothing, this tick and last
+
+	inboundTravelWays  travelWays[*Merchant]
+	outboundTravelWays travelWays[*Merchant]
+	inboundMigrations  travelWays[*Local] // locals only move between cities in the same process
+	outboundMigrations travelWays[*Local]
+	inboundGossip      travelWays[priceBulletin]
+	outboundGossip     travelWays[priceBulletin]
+	travelCosts        map[cityName]float64 // cost of travelling from this city, defaults to defaultTravelCost
+	distances          map[cityName]float64 // length of each travel way that has one
+	position           *Position            // nil if the city isn't on the map
+	transit            TransitPolicy
+	travelling         []*Merchant // on their way here, in the order they set off
+	migrants           []*Local    // moving here, in the order they set off
+
+	// a specialized city is better at producing its specialty
+	specialty   Good
+	specialized bool
 
-	locals    map[*Local]bool
-	merchants map[*Merchant]bool
+	taxPolicy     TaxPolicy
+	treasury      float64   // tax collected and not yet paid out
+	taxReport     TaxReport // for the current tick
+	lastTaxReport TaxReport
 
-	inboundTravelWays  travelWays
-	outboundTravelWays travelWays
+	bank        *Bank        // nil if the city has no bank
+	centralBank *CentralBank // nil if the city has no central bank
+	labor       *LaborMarket // nil if locals can't hire each other
 
-	networkPorts *networkedTravelWays
+	lastBankruptcies int          // firms that closed during the last tick
+	unclaimed        map[Good]int // goods of firms that closed with nobody in the city, the next local to settle takes them
+
+	demography                     *DemographyPolicy // nil if the population only changes through interventions
+	demographics, lastDemographics DemographyReport  // this tick and last
+
+	ecology   *EcologyPolicy     // nil if no goods are harvested from nature
+	ecosystem *ecology.Ecosystem // the populations goods are harvested from
+
+	gossip             *GossipPolicy   // nil if the city sends no price bulletins and ignores the ones it gets
+	bulletins          []priceBulletin // written but not sent yet
+	lastBulletinsHeard int
+
+	networkPorts  *networkedTravelWays
+	networkSecret []byte // signs messages to networked cities, nil if they aren't signed
 }
 
-// NewCity creates a city
-func NewCity(name string, col color.Color, size int) *City {
-	city := &City{
-		name:      cityName(name),
-		color:     col,
-		locals:    make(map[*Local]bool),
-		merchants: make(map[*Merchant]bool),
+// NewCity creates a city trading the goods of the tutorial. The same seed will always produce the same city
+func NewCity(name string, col color.Color, size int, seed int64) *City {
+	return defaultCatalog.NewCity(name, col, size, seed)
+}
 
-		inboundTravelWays:  travelWays{},
-		outboundTravelWays: travelWays{},
-	}
+// NewCity creates a city trading the goods of the catalog. The same seed will always produce the same city
+func (catalog *Catalog) NewCity(name string, col color.Color, size int, seed int64) *City {
+	city := newEmptyCity(name, col, catalog, newSavableSource(seed))
 
 	for i := 0; i < size; i++ {
-		city.locals[NewLocal()] = true
+		city.locals = append(city.locals, NewLocal(city.newID(LocalAgent), catalog, city.rng))
 	}
 	for i := 0; i < size/2; i++ {
-		city.merchants[NewMerchant(city, FUR)] = true
+		city.merchants = append(city.merchants, NewMerchant(city, catalog.merchantGood()))
 	}
 
-	city.networkPorts = setupNetworkedTravelWay(55555, city)
-
 	return city
 }
 
-// Update will take a time step. All residents will get their own Update method called
+// a city with nobody in it and no network ports open
+func newEmptyCity(name string, col color.Color, catalog *Catalog, source *savableSource) *City {
+	return &City{
+		name:      cityName(name),
+		color:     col,
+		catalog:   catalog,
+		locals:    make([]*Local, 0),
+		merchants: make([]*Merchant, 0),
+		traders:   make([]*Trader, 0),
+		firms:     make([]*Firm, 0),
+		unclaimed: make(map[Good]int),
+		rng:       rand.New(source),
+		source:    source,
+
+		inboundTravelWays:  travelWays[*Merchant]{},
+		outboundTravelWays: travelWays[*Merchant]{},
+		inboundMigrations:  travelWays[*Local]{},
+		outboundMigrations: travelWays[*Local]{},
+		inboundGossip:      travelWays[priceBulletin]{},
+		outboundGossip:     travelWays[priceBulletin]{},
+		travelCosts:        make(map[cityName]float64),
+		distances:          make(map[cityName]float64),
+		transit:            DefaultTransitPolicy(),
+		trades:             make(map[Good]*tradeTally),
+		ledger:             NewLedger(),
+		market:             NewSearchMarket(),
+		taxPolicy:          DefaultTaxPolicy(),
+	}
+}
+
+// Catalog returns the goods and recipes of the city
+func (city *City) Catalog() *Catalog {
+	return city.catalog
+}
+
+// Goods returns all the goods that can be traded in the city
+func (city *City) Goods() []Good {
+	return city.catalog.Goods()
+}
+
+// Update will take a time step. All residents will get their own Update method called.
+// Usually called through a Simulation, which also records the results
 func (city *City) Update() {
+	city.trades = make(map[Good]*tradeTally)
+	city.advanceTravellers()
 
 	// speed up the simulation
 	for i := 0; i < 100; i++ {
+		city.round = city.tick*100 + i
+
 		// check for new merchants
 		city.inboundTravelWays.Range(func(_ cityName, channel chan *Merchant) bool {
 			if existNewMerchant, newMerchant := city.receiveImmigrant(channel); existNewMerchant {
-				city.merchants[newMerchant] = true
-				newMerchant.city = city.name // let the merchant know they arrived
-
-				// if the merchant is rich, tax them and distribute amongst the locals
-				if newMerchant.Money > 1000.0 {
-					tax := (newMerchant.Money - 1000) / 10
-					newMerchant.Money -= tax
-					for local := range city.locals {
-						local.money += tax / float64(len(city.locals))
-					}
-				}
+				city.receiveMerchant(newMerchant)
+			}
+			return true
+		})
+		if city.networkPorts != nil {
+			for _, merchant := range city.networkPorts.takeStranded() {
+				city.receiveMerchant(merchant)
+			}
+			for _, merchant := range city.networkPorts.takeReturned() {
+				city.welcomeBack(merchant)
+			}
+		}
+		city.inboundMigrations.Range(func(_ cityName, channel chan *Local) bool {
+			if arrived, migrant := city.receiveMigrant(channel); arrived {
+				city.receiveLocal(migrant)
 			}
 			return true
 		})
 
 		// run all the agents
-		for local := range city.locals {
+		for _, local := range city.locals {
 			local.update(city)
 		}
-		for merchant := range city.merchants {
+		// merchants may leave the city while we iterate, so iterate over a copy
+		for _, merchant := range city.Merchants() {
 			merchant.update(city)
 		}
+		for _, trader := range city.traders {
+			trader.update(city)
+		}
+		for _, firm := range city.firms {
+			firm.update(city)
+		}
+	}
+
+	city.taxWealth()
+	city.redistribute()
+	city.settleFirms()
+	city.runDemography()
+	city.settleBank()
+	city.runCentralBank()
+	if city.labor != nil {
+		city.labor.rotate()
 	}
+	city.stepEcology()
+	city.spreadGossip()
+
+	city.lastLeisureTaken = city.leisureTaken
+	city.leisureTaken = 0
 
-	updateGraph(city)
+	city.tick++
 }
 
-func (city *City) allEconomicAgents() map[EconomicAgent]bool {
-	merged := make(map[EconomicAgent]bool)
-	for k, v := range city.locals {
-		merged[k] = v
+// Name returns the name of the city
+func (city *City) Name() string {
+	return string(city.name)
+}
+
+// Color returns the color the city is drawn with
+func (city *City) Color() color.Color {
+	return city.color
+}
+
+// LeisureTaken returns how many times locals chose to do nothing during the last tick
+func (city *City) LeisureTaken() int {
+	return city.lastLeisureTaken
+}
+
+// Locals returns the locals currently living in the city
+func (city *City) Locals() []*Local {
+	return append([]*Local{}, city.locals...)
+}
+
+// Merchants returns the merchants currently in the city
+func (city *City) Merchants() []*Merchant {
+	return append([]*Merchant{}, city.merchants...)
+}
+
+func (city *City) allEconomicAgents() []EconomicAgent {
+	merged := make([]EconomicAgent, 0, len(city.locals)+len(city.merchants)+len(city.traders)+len(city.firms))
+	for _, local := range city.locals {
+		merged = append(merged, local)
 	}
-	for k, v := range city.merchants {
-		merged[k] = v
+	for _, merchant := range city.merchants {
+		merged = append(merged, merchant)
+	}
+	for _, trader := range city.traders {
+		merged = append(merged, trader)
+	}
+	for _, firm := range city.firms {
+		merged = append(merged, firm)
 	}
 	return merged
 }
 
+type tradeTally struct {
+	Count int     `json:"count"`
+	Value float64 `json:"value"` // the sum of the prices
+}
+
+// trade moves one unit of a good from the seller to the buyer at the given price, all trades go through here
+func (city *City) trade(good Good, buyer, seller EconomicAgent, price float64) {
+	city.fund(buyer, price)
+	buyer.transact(good, true, price)
+	seller.transact(good, false, price)
+	city.taxTrade(good, buyer, seller, price)
+
+	if _, ok := city.trades[good]; !ok {
+		city.trades[good] = &tradeTally{}
+	}
+	city.trades[good].Count++
+	city.trades[good].Value += price
+
+	city.ledger.record(Trade{
+		Tick:       city.tick,
+		City:       string(city.name),
+		Good:       good,
+		Buyer:      buyer.id(),
+		BuyerKind:  buyer.kind(),
+		Seller:     seller.id(),
+		SellerKind: seller.kind(),
+		Price:      price,
+	})
+}
+
+// ids are prefixed with the city name so they stay unique when residents travel
+func (city *City) newID(kind AgentKind) AgentID {
+	city.nextID++
+	return AgentID(fmt.Sprintf("%s-%s-%d", city.name, kind, city.nextID))
+}
+
+// Ledger returns the record of every trade made in the city
+func (city *City) Ledger() *Ledger {
+	return city.ledger
+}
+
+// SetMarketMechanism changes how buyers and sellers in the city find each other
+func (city *City) SetMarketMechanism(market MarketMechanism) {
+	city.market = market
+}
+
+// MarketMechanism returns how buyers and sellers in the city find each other
+func (city *City) MarketMechanism() MarketMechanism {
+	return city.market
+}
+
+// whether the agent is still in the city
+func (city *City) isPresent(agent EconomicAgent) bool {
+	switch agent := agent.(type) {
+	case *Merchant:
+		return agent.city == city.name
+	case *Local:
+		for _, local := range city.locals {
+			if local == agent {
+				return true
+			}
+		}
+	case *Trader:
+		for _, trader := range city.traders {
+			if trader == agent {
+				return true
+			}
+		}
+	case *Firm:
+		for _, firm := range city.firms {
+			if firm == agent {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (city *City) removeMerchant(merchant *Merchant) {
+	for i, other := range city.merchants {
+		if other == merchant {
+			city.merchants = append(city.merchants[:i], city.merchants[i+1:]...)
+			return
+		}
+	}
+}
+
+// a merchant came off a travel way, they may still have some way to go
+func (city *City) receiveMerchant(merchant *Merchant) {
+	if merchant.TransitTicks > 0 {
+		city.travelling = append(city.travelling, merchant) // still a long way to go
+	} else {
+		city.arrive(merchant)
+	}
+}
+
+// a merchant joins the city at the end of their journey
+func (city *City) arrive(merchant *Merchant) {
+	city.merchants = append(city.merchants, merchant)
+	merchant.city = city.name // let the merchant know they arrived
+	merchant.followPlan(city)
+
+	city.taxArrival(merchant)
+	city.syncAccount(merchant)
+}
+
 func (city *City) receiveImmigrant(channel chan *Merchant) (bool, *Merchant) {
 	select { // makes this non-blocking
 	case merchant := <-channel:
@@ -106,13 +375,82 @@ func (city *City) receiveImmigrant(channel chan *Merchant) (bool, *Merchant) {
 	}
 }
 
-// CreateTravelWayToCity will make a bidirectional networked connection to another city over which merchants can travel
-func (city *City) CreateTravelWayToCity(address string) {
-	city.networkPorts.requestConnection(address)
+// DefaultNetworkPort is the first port cities try to listen on
+const DefaultNetworkPort = 55555
+
+// Listen lets other cities connect to this one over the network, trying the following ports while the port is taken.
+// Cities stay off the network until they listen
+func (city *City) Listen(port int) error {
+	if city.networkPorts != nil && !city.networkPorts.isClosed() {
+		return fmt.Errorf("%s is already listening at %s", city.name, city.NetworkAddress())
+	}
+	networkPorts, err := setupNetworkedTravelWay(port, city)
+	if err != nil {
+		return fmt.Errorf("%s can't listen: %w", city.name, err)
+	}
+	city.networkPorts = networkPorts
+	return nil
+}
+
+// CreateTravelWayToCity will make a bidirectional networked connection to another city over which merchants can travel.
+// The city must be listening
+func (city *City) CreateTravelWayToCity(address string) error {
+	if city.networkPorts == nil || city.networkPorts.isClosed() {
+		return fmt.Errorf("%s isn't listening for networked travel ways", city.name)
+	}
+	go city.networkPorts.requestConnection(address)
+	return nil
+}
+
+// SetTravelCost sets how much it costs merchants to travel from this city to another
+func (city *City) SetTravelCost(to string, cost float64) {
+	city.travelCosts[cityName(to)] = cost
+}
+
+// an explicitly set cost wins, then the cost of the distance, then defaultTravelCost
+func (city *City) travelCost(to cityName) float64 {
+	if cost, ok := city.travelCosts[to]; ok {
+		return cost
+	}
+	if distance, ok := city.distance(to); ok {
+		return distance * city.transit.CostPerDistance
+	}
+	return defaultTravelCost
+}
+
+// Specialize sets the good this city is better at producing, it only has an effect while the city is specialized
+func (city *City) Specialize(good Good) {
+	city.specialty = good
 }
 
-// Influence will make some change to the city, hopefully allowing you to run experiments on the economy
-func Influence(location cityName, value float64) {
-	// do something to influence the economy
+// SetSpecialized turns the city's specialization on or off
+func (city *City) SetSpecialized(specialized bool) {
+	city.specialized = specialized
+}
 
+// how many units of a good one production action makes
+func (city *City) productivity(good Good) int {
+	if city.specialized && city.specialty == good {
+		return 2
+	}
+	return 1
+}
+
+// RemoveLocals removes count randomly chosen locals from the city, or all of them if count is not positive
+func (city *City) RemoveLocals(count int) {
+	if count <= 0 || count >= len(city.locals) {
+		city.locals = city.locals[:0]
+		return
+	}
+	for i := 0; i < count; i++ {
+		j := city.rng.Intn(len(city.locals))
+		city.locals = append(city.locals[:j], city.locals[j+1:]...)
+	}
+}
+
+// GrantMoney gives every local in the city the same amount of money
+func (city *City) GrantMoney(amount float64) {
+	for _, local := range city.locals {
+		local.money += amount
+	}
 }
@@ -0,0 +1,310 @@
+package economy
+
+import (
+	"fmt"
+	"math"
+)
+
+// DemographyPolicy decides how locals are born, die and move to other cities. Chances are per local per tick
+type DemographyPolicy struct {
+	BirthRate  float64 `json:"birthRate,omitempty"`  // chance a local with more than BirthAbove has a child
+	BirthAbove float64 `json:"birthAbove,omitempty"` // money a local needs before they have children
+	Endowment  float64 `json:"endowment,omitempty"`  // fraction of the parent's money given to the child
+	Capacity   int     `json:"capacity,omitempty"`   // births slow down as the city fills up to this many locals, 0 is no limit
+
+	DeathRate float64 `json:"deathRate,omitempty"` // chance a local dies
+	Lifespan  int     `json:"lifespan,omitempty"`  // locals die at this age in ticks, 0 never die of old age
+
+	MigrationRate float64 `json:"migrationRate,omitempty"` // chance a local thinks about moving to a connected city
+	MigrateAbove  float64 `json:"migrateAbove,omitempty"`  // how much better off, as a fraction, a local must expect to be before they move
+}
+
+// Validate checks the policy makes sense
+func (policy DemographyPolicy) Validate() error {
+	for _, chance := range []float64{policy.BirthRate, policy.DeathRate, policy.MigrationRate} {
+		if chance < 0 || chance > 1 {
+			return fmt.Errorf("demographic rates must be between 0 and 1")
+		}
+	}
+	if policy.Endowment < 0 || policy.Endowment > 1 {
+		return fmt.Errorf("endowment must be between 0 and 1")
+	}
+	if policy.Capacity < 0 || policy.Lifespan < 0 || policy.MigrateAbove < 0 {
+		return fmt.Errorf("capacity, lifespan and migrate above can't be negative")
+	}
+	return nil
+}
+
+// DemographyReport is how a city's population changed during a tick
+type DemographyReport struct {
+	Births, Deaths        int
+	Emigrants, Immigrants int     // locals who left for and arrived from other cities
+	Inherited             float64 // money passed on by locals who died
+}
+
+// SetDemographyPolicy starts locals being born, dying and moving away, or changes how they do
+func (city *City) SetDemographyPolicy(policy DemographyPolicy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	city.demography = &policy
+	return nil
+}
+
+// DemographyPolicy returns the city's demography policy, false if its population doesn't change by itself
+func (city *City) DemographyPolicy() (DemographyPolicy, bool) {
+	if city.demography == nil {
+		return DemographyPolicy{}, false
+	}
+	return *city.demography, true
+}
+
+// DemographyReport returns how the population changed during the last tick
+func (city *City) DemographyReport() DemographyReport {
+	return city.lastDemographics
+}
+
+// locals have children, die and move away if it is their time to. Called at the end of every tick
+func (city *City) runDemography() {
+	if policy := city.demography; policy != nil {
+		city.births(*policy)
+		city.deaths(*policy)
+		city.emigrate(*policy)
+	}
+	city.lastDemographics = city.demographics
+	city.demographics = DemographyReport{}
+}
+
+func (city *City) births(policy DemographyPolicy) {
+	chance := policy.BirthRate
+	if policy.Capacity > 0 {
+		// logistic growth, a full city has no more children
+		chance *= math.Max(1-float64(len(city.locals))/float64(policy.Capacity), 0)
+	}
+
+	parents := append([]*Local{}, city.locals...) // children born this tick don't have children of their own
+	for _, parent := range parents {
+		if parent.money <= policy.BirthAbove || city.rng.Float64() >= chance {
+			continue
+		}
+		child := NewLocal(city.newID(LocalAgent), city.catalog, city.rng)
+		child.born = city.tick
+		child.parent = parent.ID
+
+		// children are born with nothing but what their parent gives them
+		child.money = parent.money * policy.Endowment
+		parent.money -= child.money
+		for good, market := range child.markets {
+			market.ownedGoods = 0
+			market.expectedMarketPrice = parent.markets[good].expectedMarketPrice
+		}
+		child.expectedWage = child.valueToPrice(child.potentialPersonalValue(LEISURE))
+
+		city.locals = append(city.locals, child)
+		city.demographics.Births++
+	}
+}
+
+func (city *City) deaths(policy DemographyPolicy) {
+	living := city.locals[:0]
+	dead := make([]*Local, 0)
+	for _, local := range city.locals {
+		if (policy.Lifespan > 0 && city.tick-local.born >= policy.Lifespan) || city.rng.Float64() < policy.DeathRate {
+			dead = append(dead, local)
+		} else {
+			living = append(living, local)
+		}
+	}
+	city.locals = living
+
+	for _, local := range dead {
+		city.bequeath(local)
+		city.demographics.Deaths++
+	}
+}
+
+// the estate of a local who died pays off their loan, then goes to their children in the city, or to everyone if they had none.
+// Whatever the bank isn't repaid it writes off, and whatever of the deposit it can't pay out yet it owes the heirs instead
+func (city *City) bequeath(local *Local) {
+	heirs := make([]*Local, 0)
+	for _, other := range city.locals {
+		if other.parent == local.ID {
+			heirs = append(heirs, other)
+		}
+	}
+	if len(heirs) == 0 {
+		heirs = city.locals
+	}
+
+	if bank := city.bank; bank != nil {
+		// what the bank owes the estate pays off what the estate owes the bank
+		if loan, ok := bank.loans[local.ID]; ok {
+			offset := math.Min(bank.deposits[local.ID], loan.Owed)
+			bank.changeDeposit(local.ID, -offset)
+			loan.Owed -= offset
+		}
+		if deposit := math.Min(bank.deposits[local.ID], bank.reserves); deposit > 0 {
+			bank.reserves -= deposit
+			bank.changeDeposit(local.ID, -deposit)
+			local.money += deposit
+		}
+		local.money = city.closeLoan(local.ID, local.money)
+		if owed := bank.deposits[local.ID]; owed > 0 && len(heirs) > 0 {
+			for _, heir := range heirs {
+				bank.changeDeposit(heir.ID, owed/float64(len(heirs)))
+			}
+			city.demographics.Inherited += owed
+		}
+		bank.changeDeposit(local.ID, -bank.deposits[local.ID])
+	}
+
+	if len(heirs) == 0 {
+		return // nobody left to inherit anything
+	}
+
+	share := local.money / float64(len(heirs))
+	for _, heir := range heirs {
+		heir.money += share
+	}
+	city.demographics.Inherited += local.money
+	local.money = 0
+
+	next := 0
+	for _, good := range city.catalog.goods {
+		for ; local.markets[good].ownedGoods > 0; local.markets[good].ownedGoods-- {
+			heirs[next%len(heirs)].markets[good].ownedGoods++
+			next++
+		}
+	}
+}
+
+// locals move to a connected city when the merchants here say their money would go further there
+func (city *City) emigrate(policy DemographyPolicy) {
+	if policy.MigrationRate <= 0 {
+		return
+	}
+	prices := city.pricesElsewhere()
+
+	staying := city.locals[:0]
+	for _, local := range city.locals {
+		if city.rng.Float64() >= policy.MigrationRate || !city.tryToMove(local, policy, prices) {
+			staying = append(staying, local)
+		}
+	}
+	city.locals = staying
+}
+
+// returns true if the local left
+func (city *City) tryToMove(local *Local, policy DemographyPolicy, prices map[cityName]map[Good]float64) bool {
+	here := make(map[Good]float64)
+	for _, good := range city.catalog.goods {
+		here[good] = local.markets[good].expectedMarketPrice
+	}
+	best := local.money * local.appeal(here) * (1 + policy.MigrateAbove)
+	destination := cityName("")
+	for _, name := range city.outboundMigrations.Names() {
+		there, ok := prices[name]
+		if !ok {
+			continue
+		}
+		if value := (local.money - city.fare(name)) * local.appeal(there); value > best {
+			best = value
+			destination = name
+		}
+	}
+	if destination == "" {
+		return false
+	}
+
+	channel, ok := city.outboundMigrations.Load(destination)
+	// only the city's own routine gets on its travel ways, so a road with room now still has room once they have packed.
+	// Checking first means a full road leaves them exactly as they were
+	if !ok || len(channel) == cap(channel) {
+		return false
+	}
+	// they take their savings with them and settle their debts, they won't be back to repay them
+	if bank := city.bank; bank != nil {
+		if deposit := math.Min(bank.deposits[local.ID], bank.reserves); deposit > 0 {
+			bank.reserves -= deposit
+			local.money += deposit
+			bank.changeDeposit(local.ID, -deposit)
+		}
+	}
+	local.money = city.closeLoan(local.ID, local.money)
+	// pay for the journey like merchants do, the longer it is the longer we are on the road
+	city.taxReport.Fares += city.collect(local, city.fare(destination))
+	local.transitTicks = city.transitTicks(destination)
+	local.debt, local.savings, local.credit = 0, 0, 0 // until they meet the bank of their new city
+	city.demographics.Emigrants++
+	channel <- local
+	return true
+}
+
+// a local came off a migration travel way, they may still have some way to go
+func (city *City) receiveLocal(local *Local) {
+	if local.transitTicks > 0 {
+		city.migrants = append(city.migrants, local)
+	} else {
+		city.settle(local)
+	}
+}
+
+// a local joins the city at the end of their move
+func (city *City) settle(local *Local) {
+	for _, good := range city.catalog.goods {
+		if market, ok := local.markets[good]; ok && city.unclaimed[good] > 0 {
+			market.ownedGoods += city.unclaimed[good]
+			delete(city.unclaimed, good)
+		}
+	}
+	city.locals = append(city.locals, local)
+	city.syncAccount(local)
+	city.demographics.Immigrants++
+}
+
+// how much utility a local expects from a dollar when spent on the good that gives them the most for it
+func (local *Local) appeal(prices map[Good]float64) float64 {
+	best := 0.0
+	for good, price := range prices { // the best is the same whatever the order
+		if price > 0 {
+			best = math.Max(best, local.potentialPersonalValue(good)/price)
+		}
+	}
+	return best
+}
+
+// what the merchants in the city believe goods sell for in the cities they know about, averaged over the merchants who know
+func (city *City) pricesElsewhere() map[cityName]map[Good]float64 {
+	sums := make(map[cityName]map[Good]float64)
+	counts := make(map[cityName]map[Good]int)
+	for _, merchant := range city.merchants {
+		for _, good := range city.catalog.goods {
+			for _, name := range city.outboundMigrations.Names() {
+				if price := merchant.ExpectedPrices[good][name]; price > 0 {
+					if _, ok := sums[name]; !ok {
+						sums[name] = make(map[Good]float64)
+						counts[name] = make(map[Good]int)
+					}
+					sums[name][good] += price
+					counts[name][good]++
+				}
+			}
+		}
+	}
+	for name, byGood := range sums {
+		for good := range byGood {
+			byGood[good] /= float64(counts[name][good])
+		}
+	}
+	return sums
+}
+
+// arriving locals join the city, they keep everything they brought with them
+func (city *City) receiveMigrant(channel chan *Local) (bool, *Local) {
+	select { // makes this non-blocking
+	case local := <-channel:
+		return true, local
+	default:
+		return false, nil
+	}
+}
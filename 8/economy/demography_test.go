@@ -0,0 +1,78 @@
+package economy
+
+import (
+	"image/color"
+	"math"
+	"testing"
+)
+
+// a city whose first local has 100 saved, owes 30 and would rather live in Second
+func migrationTestCity(t *testing.T) (*City, *Local, map[cityName]map[Good]float64) {
+	t.Helper()
+	first := NewCity("First", color.White, 5, 1)
+	second := NewCity("Second", color.Black, 5, 2)
+	RegisterTravelWay(first, second)
+	if err := first.SetDistance("Second", 2); err != nil {
+		t.Fatal(err)
+	}
+	first.SetTravelCost("Second", 5)
+	if err := first.SetBankPolicy(BankPolicy{Capital: 1000, CreditLimit: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	local := first.locals[0]
+	local.money = 50
+	first.bank.changeDeposit(local.ID, 100)
+	first.bank.reserves += 100
+	first.bank.loans[local.ID] = &loan{Owed: 30}
+	first.syncAccount(local)
+
+	cheap := make(map[Good]float64)
+	for _, good := range first.catalog.goods {
+		cheap[good] = 0.01
+	}
+	return first, local, map[cityName]map[Good]float64{"Second": cheap}
+}
+
+func TestMigrantsSettleTheirLoan(t *testing.T) {
+	city, local, prices := migrationTestCity(t)
+	reserves := city.bank.reserves
+
+	if !city.tryToMove(local, DemographyPolicy{}, prices) {
+		t.Fatal("the local didn't move")
+	}
+	if _, ok := city.bank.loans[local.ID]; ok {
+		t.Error("the migrant's loan is still open")
+	}
+	if city.bank.Deposit(local.ID) != 0 {
+		t.Error("the migrant left their deposit behind")
+	}
+	if math.Abs(local.money-115) > 1e-9 {
+		t.Errorf("the migrant left with %.2f, expected 50+100-30-5", local.money)
+	}
+	if math.Abs(city.bank.reserves-(reserves-70)) > 1e-9 {
+		t.Errorf("the bank has %.2f in reserve, expected %.2f", city.bank.reserves, reserves-70)
+	}
+}
+
+func TestFullRoadLeavesMigrantsAsTheyWere(t *testing.T) {
+	city, local, prices := migrationTestCity(t)
+	channel, _ := city.outboundMigrations.Load("Second")
+	for len(channel) < cap(channel) {
+		channel <- NewLocal(city.newID(LocalAgent), city.catalog, city.rng)
+	}
+	reserves, treasury := city.bank.reserves, city.treasury
+
+	if city.tryToMove(local, DemographyPolicy{}, prices) {
+		t.Fatal("the local moved along a full road")
+	}
+	if local.money != 50 || city.bank.Deposit(local.ID) != 100 || city.bank.Owed(local.ID) != 30 {
+		t.Errorf("the local has %.2f, %.2f deposited and owes %.2f, expected 50, 100 and 30", local.money, city.bank.Deposit(local.ID), city.bank.Owed(local.ID))
+	}
+	if local.savings != 100 || local.debt != 30 {
+		t.Errorf("the local thinks they have %.2f saved and owe %.2f", local.savings, local.debt)
+	}
+	if city.bank.reserves != reserves || city.treasury != treasury || local.transitTicks != 0 {
+		t.Error("trying to move along a full road changed the bank, the treasury or the local's journey")
+	}
+}
@@ -0,0 +1,264 @@
+package economy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultRegistryAddress is where cities look for the registry unless told otherwise
+const DefaultRegistryAddress = "127.0.0.1:55550"
+
+// how often a city tells the registry it is still running and looks for neighbours to connect to
+const advertiseInterval = 2 * time.Second
+
+// PeerInfo is what a city tells the registry about itself
+type PeerInfo struct {
+	City      string    `json:"city"`
+	Address   string    `json:"address"`             // where its networked travel ways listen
+	Connected []string  `json:"connected,omitempty"` // cities it has a networked travel way to
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+// Registry keeps track of which cities are running and where they listen, so processes can find each other.
+// Cities that stop advertising are forgotten after the ttl
+type Registry struct {
+	ttl   time.Duration
+	mutex sync.Mutex
+	peers map[string]PeerInfo
+}
+
+// NewRegistry creates an empty registry, serve it over HTTP to let cities use it
+func NewRegistry(ttl time.Duration) *Registry {
+	return &Registry{
+		ttl:   ttl,
+		peers: make(map[string]PeerInfo),
+	}
+}
+
+// Peers returns the cities that advertised recently, in order of name
+func (registry *Registry) Peers() []PeerInfo {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	peers := make([]PeerInfo, 0, len(registry.peers))
+	for name, info := range registry.peers {
+		if time.Since(info.LastSeen) > registry.ttl {
+			delete(registry.peers, name)
+			continue
+		}
+		peers = append(peers, info)
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].City < peers[j].City })
+	return peers
+}
+
+// ServeHTTP answers GET /peers with every known city, and POST /peers adds or refreshes a city before answering the same
+func (registry *Registry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/peers" {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		info := PeerInfo{}
+		if err := json.NewDecoder(r.Body).Decode(&info); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if info.City == "" || info.Address == "" {
+			http.Error(w, "a city needs a name and an address", http.StatusBadRequest)
+			return
+		}
+		info.LastSeen = time.Now()
+
+		registry.mutex.Lock()
+		registry.peers[info.City] = info
+		registry.mutex.Unlock()
+	default:
+		http.Error(w, "only GET and POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(registry.Peers())
+}
+
+// ListPeers asks the registry at the address which cities are running
+func ListPeers(registryAddress string) ([]PeerInfo, error) {
+	response, err := http.Get(registryURL(registryAddress))
+	if err != nil {
+		return nil, err
+	}
+	return readPeers(response)
+}
+
+func advertise(registryAddress string, info PeerInfo) ([]PeerInfo, error) {
+	body, err := json.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+	response, err := http.Post(registryURL(registryAddress), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	return readPeers(response)
+}
+
+func readPeers(response *http.Response) ([]PeerInfo, error) {
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("registry answered %s", response.Status)
+	}
+	peers := make([]PeerInfo, 0)
+	if err := json.NewDecoder(response.Body).Decode(&peers); err != nil {
+		return nil, fmt.Errorf("registry sent a bad peer list: %w", err)
+	}
+	return peers, nil
+}
+
+func registryURL(registryAddress string) string {
+	return "http://" + registryAddress + "/peers"
+}
+
+// Topology says which cities should have a networked travel way between them. Each connection goes both ways
+type Topology struct {
+	Connections []TopologyConnection `json:"connections"`
+}
+
+// TopologyConnection is one networked travel way, it doesn't matter which city is From
+type TopologyConnection struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// LoadTopology reads a topology from a JSON file
+func LoadTopology(path string) (Topology, error) {
+	topology := Topology{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return topology, err
+	}
+	if err := json.Unmarshal(data, &topology); err != nil {
+		return topology, fmt.Errorf("topology %s: %w", path, err)
+	}
+	if err := topology.Validate(); err != nil {
+		return topology, fmt.Errorf("topology %s: %w", path, err)
+	}
+	return topology, nil
+}
+
+// Validate checks every connection joins two different, named cities
+func (topology Topology) Validate() error {
+	for i, connection := range topology.Connections {
+		if connection.From == "" || connection.To == "" {
+			return fmt.Errorf("connection %d needs both from and to", i)
+		}
+		if connection.From == connection.To {
+			return fmt.Errorf("connection %d joins %s to itself", i, connection.From)
+		}
+	}
+	return nil
+}
+
+// the cities the topology connects to a city, in order of name
+func (topology Topology) neighbours(city cityName) []cityName {
+	found := make(map[cityName]bool)
+	for _, connection := range topology.Connections {
+		if cityName(connection.From) == city {
+			found[cityName(connection.To)] = true
+		}
+		if cityName(connection.To) == city {
+			found[cityName(connection.From)] = true
+		}
+	}
+	neighbours := make([]cityName, 0, len(found))
+	for name := range found {
+		neighbours = append(neighbours, name)
+	}
+	sort.Slice(neighbours, func(i, j int) bool { return neighbours[i] < neighbours[j] })
+	return neighbours
+}
+
+// NetworkAddress returns where the city listens for networked travel ways, or "" if it doesn't
+func (city *City) NetworkAddress() string {
+	if city.networkPorts == nil {
+		return ""
+	}
+	return city.networkPorts.server.Addr().String()
+}
+
+// NetworkPeers returns the cities connected over the network, in order of name
+func (city *City) NetworkPeers() []string {
+	if city.networkPorts == nil {
+		return nil
+	}
+	city.networkPorts.mutex.Lock()
+	defer city.networkPorts.mutex.Unlock()
+
+	peers := make([]string, 0, len(city.networkPorts.connected))
+	for name := range city.networkPorts.connected {
+		peers = append(peers, string(name))
+	}
+	sort.Strings(peers)
+	return peers
+}
+
+// JoinMesh keeps the city advertised at the registry, and connects it to its neighbours in the topology as they show up, until the city is closed.
+// Of two neighbours only the one whose name comes first dials, so they don't both try at once
+func (city *City) JoinMesh(registryAddress string, topology Topology) error {
+	if city.networkPorts == nil {
+		return fmt.Errorf("%s isn't listening for networked travel ways", city.name)
+	}
+	if err := topology.Validate(); err != nil {
+		return err
+	}
+
+	go func() {
+		lastErr := ""
+		for {
+			peers, err := advertise(registryAddress, PeerInfo{
+				City:      string(city.name),
+				Address:   city.NetworkAddress(),
+				Connected: city.NetworkPeers(),
+			})
+			// only say something when the registry starts or stops answering, not every time we ask
+			if err != nil && err.Error() != lastErr {
+				fmt.Printf("%s can't reach the registry: %v\n", city.name, err)
+				lastErr = err.Error()
+			} else if err == nil && lastErr != "" {
+				fmt.Printf("%s reached the registry\n", city.name)
+				lastErr = ""
+			}
+
+			connected := make(map[string]bool)
+			for _, name := range city.NetworkPeers() {
+				connected[name] = true
+			}
+			for _, neighbour := range topology.neighbours(city.name) {
+				if neighbour < city.name || connected[string(neighbour)] {
+					continue
+				}
+				for _, info := range peers {
+					if cityName(info.City) == neighbour {
+						city.networkPorts.requestConnection(info.Address)
+					}
+				}
+			}
+
+			select {
+			case <-time.After(advertiseInterval):
+			case <-city.networkPorts.quit:
+				return // the city left the network
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,483 @@
+package economy
+
+import (
+	"fmt"
+	"math"
+)
+
+// FirmPolicy describes what a firm makes and how it is run
+type FirmPolicy struct {
+	Recipe        string  `json:"recipe"`                  // the name of the recipe the firm runs, it must have inputs
+	Capacity      int     `json:"capacity"`                // the most times the firm can run its recipe each tick
+	Capital       float64 `json:"capital"`                 // money the firm starts with
+	Markup        float64 `json:"markup,omitempty"`        // the firm never sells for less than what the goods cost it times 1 + markup
+	DividendAbove float64 `json:"dividendAbove,omitempty"` // at the end of every tick money above this is paid out to the locals, 0 never pays
+	BankruptAfter int     `json:"bankruptAfter,omitempty"` // ticks in a row the firm can be insolvent before it closes, defaults to defaultBankruptAfter
+}
+
+const defaultBankruptAfter = 20
+
+// DefaultFirmPolicy is a small chair maker
+func DefaultFirmPolicy() FirmPolicy {
+	return FirmPolicy{Recipe: "build chair", Capacity: 5, Capital: 1000, Markup: 0.1}
+}
+
+// Validate checks the policy makes sense with the recipes of the catalog
+func (policy FirmPolicy) Validate(catalog *Catalog) error {
+	recipe, ok := catalog.recipe(policy.Recipe)
+	if !ok {
+		return fmt.Errorf("unknown recipe %q", policy.Recipe)
+	}
+	if len(recipe.Inputs) == 0 {
+		return fmt.Errorf("recipe %s needs no inputs, firms only convert goods", recipe.Name)
+	}
+	if policy.Capacity <= 0 {
+		return fmt.Errorf("firm capacity must be positive")
+	}
+	if policy.Capital < 0 || policy.Markup < 0 || policy.DividendAbove < 0 {
+		return fmt.Errorf("firm capital, markup and dividends can't be negative")
+	}
+	if policy.BankruptAfter < 0 {
+		return fmt.Errorf("bankrupt after can't be negative")
+	}
+	return nil
+}
+
+// FirmReport is how a firm did during a tick
+type FirmReport struct {
+	Revenue   float64 // from selling outputs
+	Costs     float64 // what the outputs sold had cost to make, and what unsold stock was written down by
+	Purchases float64 // spent on inputs
+	Profit    float64 // revenue minus costs, before taxes and interest
+	Produced  int     // units of output made
+	Sold      int
+}
+
+// Firm buys inputs, turns them into outputs with its recipe and sells them.
+// Goods are valued at what they cost, so profit is only made when outputs sell for more than their inputs did
+type Firm struct {
+	ID        AgentID
+	catalog   *Catalog
+	policy    FirmPolicy
+	recipe    Recipe
+	money     float64
+	debt      float64 // owed to the city's bank
+	inventory map[Good]int
+	costs     map[Good]float64    // what the units in inventory cost, in total
+	expected  map[Good]float64    // what the firm believes each good sells for
+	beliefs   map[Good]BeliefRule // how those beliefs change
+	rule      string              // the name of the belief rule
+	idle      map[Good]int        // updates since each good was last traded
+
+	runs      int // times the recipe was run this tick
+	insolvent int // ticks in a row the firm has been insolvent
+
+	report, lastReport FirmReport
+}
+
+// NewFirm creates a firm with its capital and no goods. It starts off believing what the locals of the city believe
+func NewFirm(city *City, policy FirmPolicy, beliefs string) (*Firm, error) {
+	if err := policy.Validate(city.catalog); err != nil {
+		return nil, err
+	}
+	recipe, _ := city.catalog.recipe(policy.Recipe)
+	firm := &Firm{
+		ID:        city.newID(FirmAgent),
+		catalog:   city.catalog,
+		policy:    policy,
+		recipe:    recipe,
+		money:     policy.Capital,
+		inventory: make(map[Good]int),
+		costs:     make(map[Good]float64),
+		expected:  make(map[Good]float64),
+		beliefs:   make(map[Good]BeliefRule),
+		rule:      beliefs,
+		idle:      make(map[Good]int),
+	}
+
+	for _, good := range firm.goods() {
+		rule, err := NewBeliefRule(beliefs)
+		if err != nil {
+			return nil, err
+		}
+		firm.beliefs[good] = rule
+		firm.expected[good] = city.meanExpectedPrice(good)
+	}
+
+	return firm, nil
+}
+
+func init() {
+	RegisterAgentKind(string(FirmAgent), func(city *City, beliefs string) error {
+		if beliefs == "" {
+			beliefs = SmoothedBeliefsName
+		}
+		firm, err := NewFirm(city, DefaultFirmPolicy(), beliefs)
+		if err != nil {
+			return err
+		}
+		city.firms = append(city.firms, firm)
+		return nil
+	})
+}
+
+// AddFirm opens a firm in the city
+func (city *City) AddFirm(policy FirmPolicy) error {
+	firm, err := NewFirm(city, policy, SmoothedBeliefsName)
+	if err != nil {
+		return err
+	}
+	city.firms = append(city.firms, firm)
+	return nil
+}
+
+// Firms returns the firms currently open in the city
+func (city *City) Firms() []*Firm {
+	return append([]*Firm{}, city.firms...)
+}
+
+// Bankruptcies returns how many firms closed during the last tick
+func (city *City) Bankruptcies() int {
+	return city.lastBankruptcies
+}
+
+// the goods the firm deals in, inputs first
+func (firm *Firm) goods() []Good {
+	dealt := make([]Good, 0, len(firm.recipe.Inputs)+len(firm.recipe.Outputs))
+	for _, ingredient := range append(append([]Ingredient{}, firm.recipe.Inputs...), firm.recipe.Outputs...) {
+		dealt = append(dealt, ingredient.Good)
+	}
+	return dealt
+}
+
+func (firm *Firm) isInput(good Good) bool {
+	for _, input := range firm.recipe.Inputs {
+		if input.Good == good {
+			return true
+		}
+	}
+	return false
+}
+
+func (firm *Firm) update(city *City) {
+	// firms are as busy as everyone else
+	if city.rng.Float64() > 0.1 {
+		return
+	}
+
+	for firm.runs < firm.policy.Capacity && firm.canRun() {
+		firm.run(city)
+	}
+
+	nearbyAgents := city.allEconomicAgents()
+	for _, good := range firm.goods() {
+		// hear what someone else thinks
+		if len(nearbyAgents) > 0 {
+			if otherAgent := nearbyAgents[city.rng.Intn(len(nearbyAgents))]; otherAgent != firm {
+				if heard, ok := otherAgent.gossip(good); ok {
+					firm.expected[good] = firm.beliefs[good].Heard(firm.expected[good], firm.catalog.meanVolatility(good), heard)
+				}
+			}
+		}
+
+		trying := false
+		if firm.isInput(good) {
+			// keep enough in stock to run at capacity for a tick
+			if isBuyer, bid := firm.isBuying(city, good); isBuyer {
+				trying = true
+				if spendingPower := city.spendingPower(firm); spendingPower > 0 {
+					city.market.buy(city, good, firm, math.Min(bid, spendingPower), nearbyAgents)
+				}
+			}
+		} else {
+			trying = firm.inventory[good] > 0
+			city.market.offer(city, good, firm)
+		}
+
+		// if we haven't traded in a while then we have to pay more for inputs or ask less for outputs
+		if trying {
+			firm.idle[good]++
+			if firm.idle[good] > traderPatience {
+				firm.idle[good] = 0
+				firm.expected[good] = firm.beliefs[good].Stale(firm.expected[good], firm.catalog.meanVolatility(good), firm.isInput(good))
+				if !firm.isInput(good) {
+					firm.writeDown(good)
+				}
+			}
+		}
+	}
+}
+
+func (firm *Firm) inputCount(good Good) int {
+	for _, input := range firm.recipe.Inputs {
+		if input.Good == good {
+			return input.Count
+		}
+	}
+	return 0
+}
+
+func (firm *Firm) canRun() bool {
+	for _, input := range firm.recipe.Inputs {
+		if firm.inventory[input.Good] < input.Count {
+			return false
+		}
+	}
+	return true
+}
+
+// runs the recipe once, what the inputs cost is passed on to the outputs
+func (firm *Firm) run(city *City) {
+	cost := 0.0
+	for _, input := range firm.recipe.Inputs {
+		used := firm.costs[input.Good] * float64(input.Count) / float64(firm.inventory[input.Good])
+		firm.costs[input.Good] -= used
+		firm.inventory[input.Good] -= input.Count
+		cost += used
+	}
+
+	made := make([]int, len(firm.recipe.Outputs))
+	total := 0
+	for i, output := range firm.recipe.Outputs {
+		made[i] = city.harvest(output.Good, output.Count*city.productivity(output.Good))
+		total += made[i]
+	}
+	if total == 0 {
+		firm.report.Costs += cost // nothing left to harvest, the inputs were wasted
+	}
+	for i, output := range firm.recipe.Outputs {
+		if made[i] == 0 {
+			continue
+		}
+		firm.inventory[output.Good] += made[i]
+		firm.costs[output.Good] += cost * float64(made[i]) / float64(total)
+		firm.report.Produced += made[i]
+	}
+	firm.runs++
+}
+
+// the most the firm would pay for an input: what it expects to pay, as long as the outputs would still cover the markup
+func (firm *Firm) bid(city *City, good Good) float64 {
+	revenue := 0.0
+	for _, output := range firm.recipe.Outputs {
+		revenue += firm.expected[output.Good] * city.expectedYield(output.Good, output.Count)
+	}
+	available := revenue / (1 + firm.policy.Markup)
+	for _, input := range firm.recipe.Inputs {
+		if input.Good != good {
+			available -= firm.expected[input.Good] * float64(input.Count)
+		}
+	}
+	ceiling := available / float64(firm.inputCount(good))
+	if ceiling <= 0 {
+		return 0
+	}
+	return math.Min(firm.expected[good], ceiling)
+}
+
+// stock that won't sell for what it cost is worth less than it cost, so the firm takes the loss and lowers its price
+func (firm *Firm) writeDown(good Good) {
+	worth := firm.expected[good] / (1 + firm.policy.Markup) * float64(firm.inventory[good])
+	if loss := firm.costs[good] - worth; loss > 0 {
+		firm.costs[good] -= loss
+		firm.report.Costs += loss
+	}
+}
+
+// what one unit of a good cost the firm, 0 if it has none
+func (firm *Firm) unitCost(good Good) float64 {
+	if firm.inventory[good] <= 0 {
+		return 0
+	}
+	return firm.costs[good] / float64(firm.inventory[good])
+}
+
+func (firm *Firm) isSelling(good Good) (bool, float64) {
+	if firm.isInput(good) || firm.inventory[good] <= 0 {
+		return false, 0
+	}
+	return true, math.Max(firm.expected[good], firm.unitCost(good)*(1+firm.policy.Markup))
+}
+
+func (firm *Firm) isBuying(city *City, good Good) (bool, float64) {
+	if !firm.isInput(good) || firm.inventory[good] >= firm.policy.Capacity*firm.inputCount(good) {
+		return false, 0
+	}
+	bid := firm.bid(city, good)
+	return bid > 0, bid
+}
+
+func (firm *Firm) transact(good Good, buying bool, price float64) {
+	firm.idle[good] = 0
+	if buying {
+		firm.money -= price
+		firm.inventory[good]++
+		firm.costs[good] += price
+		firm.report.Purchases += price
+	} else {
+		cost := firm.unitCost(good)
+		firm.money += price
+		firm.inventory[good]--
+		firm.costs[good] -= cost
+		firm.report.Revenue += price
+		firm.report.Costs += cost
+		firm.report.Sold++
+	}
+	firm.expected[good] = firm.beliefs[good].Traded(firm.expected[good], firm.catalog.meanVolatility(good), buying, price)
+}
+
+func (firm *Firm) gossip(good Good) (float64, bool) {
+	expected, ok := firm.expected[good] // firms only know about the goods they deal in
+	return expected, ok
+}
+
+func (firm *Firm) id() AgentID {
+	return firm.ID
+}
+
+func (firm *Firm) kind() AgentKind {
+	return FirmAgent
+}
+
+func (firm *Firm) balance() float64 {
+	return firm.money
+}
+
+func (firm *Firm) addMoney(amount float64) {
+	firm.money += amount
+}
+
+func (firm *Firm) setDebt(_ cityName, debt float64) {
+	firm.debt = debt
+}
+
+func (firm *Firm) strategy() string {
+	return string(FirmAgent) + "/" + firm.recipe.Name
+}
+
+func (firm *Firm) holding(good Good) int {
+	return firm.inventory[good]
+}
+
+// what the firm would have if it closed now, its inventory valued at what it cost
+func (firm *Firm) netWorth() float64 {
+	worth := firm.money - firm.debt
+	for _, good := range firm.goods() {
+		worth += math.Max(firm.costs[good], 0)
+	}
+	return worth
+}
+
+// pays dividends, closes insolvent firms and starts new reports. Called at the end of every tick.
+// A firm is insolvent when it owes more than it has, or has nothing to sell and can't afford to make anything.
+// When it closes its creditors are paid first, then whatever is left goes to the locals
+func (city *City) settleFirms() {
+	city.lastBankruptcies = 0
+	open := city.firms[:0]
+	for _, firm := range city.firms {
+		firm.report.Profit = firm.report.Revenue - firm.report.Costs
+		firm.lastReport = firm.report
+		firm.report = FirmReport{}
+		firm.runs = 0
+
+		if firm.netWorth() < 0 || firm.stuck(city) {
+			firm.insolvent++
+		} else {
+			firm.insolvent = 0
+		}
+		bankruptAfter := firm.policy.BankruptAfter
+		if bankruptAfter == 0 {
+			bankruptAfter = defaultBankruptAfter
+		}
+		if firm.insolvent > bankruptAfter {
+			city.liquidate(firm)
+			city.lastBankruptcies++
+			continue
+		}
+
+		if excess := firm.money - firm.policy.DividendAbove; firm.policy.DividendAbove > 0 && excess > 0 && len(city.locals) > 0 {
+			firm.money -= excess
+			city.GrantMoney(excess / float64(len(city.locals)))
+		}
+		open = append(open, firm)
+	}
+	city.firms = open
+}
+
+func (firm *Firm) stuck(city *City) bool {
+	for _, output := range firm.recipe.Outputs {
+		if firm.inventory[output.Good] > 0 {
+			return false
+		}
+	}
+	if firm.canRun() {
+		return false
+	}
+	needed := 0.0
+	for _, input := range firm.recipe.Inputs {
+		if missing := input.Count - firm.inventory[input.Good]; missing > 0 {
+			needed += firm.bid(city, input.Good) * float64(missing)
+		}
+	}
+	return needed <= 0 || city.spendingPower(firm) < needed
+}
+
+// the bank is repaid what it can be and writes off the rest, the locals split the rest of the money and take the goods in turn.
+// In a city nobody lives in the money goes to the treasury and the goods wait for whoever settles there next
+func (city *City) liquidate(firm *Firm) {
+	firm.money = city.closeLoan(firm.ID, firm.money)
+	if len(city.locals) == 0 {
+		if firm.money > 0 {
+			city.treasury += firm.money
+			firm.money = 0
+		}
+		for _, good := range firm.goods() {
+			if firm.inventory[good] > 0 {
+				city.unclaimed[good] += firm.inventory[good]
+				firm.inventory[good] = 0
+			}
+		}
+		return
+	}
+	if firm.money > 0 {
+		city.GrantMoney(firm.money / float64(len(city.locals)))
+		firm.money = 0
+	}
+	next := 0
+	for _, good := range firm.goods() {
+		for ; firm.inventory[good] > 0; firm.inventory[good]-- {
+			city.locals[next%len(city.locals)].markets[good].ownedGoods++
+			next++
+		}
+	}
+}
+
+// Money returns how much money the firm has
+func (firm *Firm) Money() float64 {
+	return firm.money
+}
+
+// Debt returns how much the firm owes the bank
+func (firm *Firm) Debt() float64 {
+	return firm.debt
+}
+
+// Inventory returns how many of a good the firm holds
+func (firm *Firm) Inventory(good Good) int {
+	return firm.inventory[good]
+}
+
+// ExpectedPrice returns what the firm believes a good sells for
+func (firm *Firm) ExpectedPrice(good Good) float64 {
+	return firm.expected[good]
+}
+
+// Policy returns how the firm is run
+func (firm *Firm) Policy() FirmPolicy {
+	return firm.policy
+}
+
+// Report returns how the firm did during the last tick
+func (firm *Firm) Report() FirmReport {
+	return firm.lastReport
+}
@@ -0,0 +1,48 @@
+package economy
+
+import (
+	"math"
+	"testing"
+)
+
+func TestLiquidatingInAnEmptyCityKeepsEverything(t *testing.T) {
+	_, simulation := buildScenario(t, "firms")
+	simulation.Run(20)
+	city, _ := simulation.City("RIVERWOOD")
+	newcomer := city.locals[0]
+	city.locals = nil
+
+	money := city.treasury
+	goods := make(map[Good]int)
+	for _, firm := range city.firms {
+		money += firm.money
+		for _, good := range firm.goods() {
+			goods[good] += firm.inventory[good]
+		}
+	}
+	for _, firm := range city.firms {
+		city.liquidate(firm)
+	}
+	city.firms = nil
+
+	if math.Abs(city.treasury-money) > 1e-9 {
+		t.Errorf("the treasury has %.2f, expected the %.2f the firms and treasury had", city.treasury, money)
+	}
+	held := make(map[Good]int)
+	for good, units := range goods {
+		held[good] = newcomer.markets[good].ownedGoods
+		if city.unclaimed[good] != units {
+			t.Errorf("%d %s are unclaimed, expected %d", city.unclaimed[good], good, units)
+		}
+	}
+
+	city.settle(newcomer)
+	for good, units := range goods {
+		if got := newcomer.markets[good].ownedGoods - held[good]; got != units {
+			t.Errorf("the first local to settle got %d %s, expected %d", got, good, units)
+		}
+	}
+	if len(city.unclaimed) != 0 {
+		t.Errorf("goods are still unclaimed: %v", city.unclaimed)
+	}
+}
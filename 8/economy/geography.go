@@ -0,0 +1,128 @@
+package economy
+
+import (
+	"fmt"
+	"math"
+)
+
+// Position is where a city is on the map
+type Position struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Distance is how far apart two positions are in a straight line
+func (position Position) Distance(other Position) float64 {
+	return math.Hypot(position.X-other.X, position.Y-other.Y)
+}
+
+// TransitPolicy turns the length of a travel way into how long it takes to travel and what it costs.
+// Only travel ways with a distance are affected, merchants cross the others instantly like they always have
+type TransitPolicy struct {
+	Speed           float64 `json:"speed"`           // distance a merchant covers each tick
+	CostPerDistance float64 `json:"costPerDistance"` // paid from the merchant's money as they leave, unless the travel cost was set directly
+}
+
+// DefaultTransitPolicy has merchants cover 5 units of distance a tick and pay half a dollar for each
+func DefaultTransitPolicy() TransitPolicy {
+	return TransitPolicy{Speed: 5, CostPerDistance: 0.5}
+}
+
+// Validate checks the policy makes sense
+func (policy TransitPolicy) Validate() error {
+	if policy.Speed <= 0 {
+		return fmt.Errorf("transit speed must be positive")
+	}
+	if policy.CostPerDistance < 0 {
+		return fmt.Errorf("transit cost per distance can't be negative")
+	}
+	return nil
+}
+
+// SetPosition places the city on the map
+func (city *City) SetPosition(position Position) {
+	city.position = &position
+}
+
+// Position returns where the city is on the map, false if it hasn't been placed
+func (city *City) Position() (Position, bool) {
+	if city.position == nil {
+		return Position{}, false
+	}
+	return *city.position, true
+}
+
+// SetDistance sets the length of the travel way from this city to another
+func (city *City) SetDistance(to string, distance float64) error {
+	if distance < 0 {
+		return fmt.Errorf("distance to %s can't be negative", to)
+	}
+	city.distances[cityName(to)] = distance
+	return nil
+}
+
+// SetTransitPolicy changes how fast and how expensive travelling from this city is
+func (city *City) SetTransitPolicy(policy TransitPolicy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	city.transit = policy
+	return nil
+}
+
+// TransitPolicy returns how fast and how expensive travelling from this city is
+func (city *City) TransitPolicy() TransitPolicy {
+	return city.transit
+}
+
+// Travelling returns the merchants on their way to this city who haven't arrived yet
+func (city *City) Travelling() []*Merchant {
+	return append([]*Merchant{}, city.travelling...)
+}
+
+func (city *City) distance(to cityName) (float64, bool) {
+	distance, ok := city.distances[to]
+	return distance, ok
+}
+
+// how many ticks it takes to reach another city, 0 arrives during the next round
+func (city *City) transitTicks(to cityName) int {
+	distance, ok := city.distance(to)
+	if !ok {
+		return 0
+	}
+	return int(math.Ceil(distance / city.transit.Speed))
+}
+
+// what a merchant actually pays to travel to another city, only travel ways with a distance charge anything
+func (city *City) fare(to cityName) float64 {
+	if _, ok := city.distance(to); !ok {
+		return 0
+	}
+	return city.travelCost(to)
+}
+
+// merchants and migrants on the road get one tick closer, and those who made it join the city
+func (city *City) advanceTravellers() {
+	stillTravelling := city.travelling[:0]
+	for _, merchant := range city.travelling {
+		merchant.TransitTicks--
+		if merchant.TransitTicks > 0 {
+			stillTravelling = append(stillTravelling, merchant)
+		} else {
+			city.arrive(merchant)
+		}
+	}
+	city.travelling = stillTravelling
+
+	stillMoving := city.migrants[:0]
+	for _, local := range city.migrants {
+		local.transitTicks--
+		if local.transitTicks > 0 {
+			stillMoving = append(stillMoving, local)
+		} else {
+			city.settle(local)
+		}
+	}
+	city.migrants = stillMoving
+}
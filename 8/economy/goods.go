@@ -0,0 +1,180 @@
+package economy
+
+import (
+	"fmt"
+)
+
+// GoodDefinition describes a good and how locals value it. Each local draws their own preferences from these ranges
+type GoodDefinition struct {
+	Name Good `json:"name"`
+
+	BasePersonalValue       float64 `json:"basePersonalValue"`       // the lowest value a local can put on their first unit
+	BasePersonalValueSpread float64 `json:"basePersonalValueSpread"` // locals value the first unit up to this much more
+	HalfPersonalValueAt     float64 `json:"halfPersonalValueAt"`     // how many units until the value has halved
+	Volatility              float64 `json:"volatility,omitempty"`    // how much beliefs move on each trade, as a fraction of the base value. Defaults to defaultVolatility
+
+	InitialOwned int     `json:"initialOwned"`          // locals start with up to (but not including) this many
+	BreakChance  float64 `json:"breakChance,omitempty"` // chance each update that a local loses one unit
+}
+
+// Ingredient is an amount of a good used or made by a recipe
+type Ingredient struct {
+	Good  Good `json:"good"`
+	Count int  `json:"count"`
+}
+
+// Recipe is a production action a local can take, turning inputs into outputs
+type Recipe struct {
+	Name    string       `json:"name"`
+	Inputs  []Ingredient `json:"inputs"`
+	Outputs []Ingredient `json:"outputs"`
+}
+
+const defaultVolatility = 1.0 / 50.0
+
+// Catalog holds the goods and recipes of an economy. Every city of a simulation shares one, and it doesn't change once made
+type Catalog struct {
+	goods       []Good // the tradable goods (everything but leisure) in a stable order
+	definitions map[Good]GoodDefinition
+	recipes     []Recipe
+}
+
+// the goods and recipes of the tutorial, used by cities made with NewCity
+var defaultCatalog = mustCatalog(DefaultGoods(), DefaultRecipes())
+
+func mustCatalog(definitions []GoodDefinition, recipes []Recipe) *Catalog {
+	catalog, err := NewCatalog(definitions, recipes)
+	if err != nil {
+		panic(err)
+	}
+	return catalog
+}
+
+// DefaultCatalog returns the goods and recipes of the tutorial
+func DefaultCatalog() *Catalog {
+	return defaultCatalog
+}
+
+// DefaultGoods are the goods of the tutorial: wood, chairs, fur, beds and leisure
+func DefaultGoods() []GoodDefinition {
+	return []GoodDefinition{
+		{Name: WOOD, BasePersonalValue: 4, BasePersonalValueSpread: 4, HalfPersonalValueAt: 15, InitialOwned: 20},
+		{Name: CHAIR, BasePersonalValue: 30, BasePersonalValueSpread: 20, HalfPersonalValueAt: 5, InitialOwned: 10, BreakChance: 0.01},
+		{Name: FUR, BasePersonalValue: 1, BasePersonalValueSpread: 2, HalfPersonalValueAt: 50, InitialOwned: 30},
+		{Name: BED, BasePersonalValue: 50, BasePersonalValueSpread: 10, HalfPersonalValueAt: 2, InitialOwned: 2, BreakChance: 0.01},
+		{Name: LEISURE, BasePersonalValue: 2, BasePersonalValueSpread: 4, HalfPersonalValueAt: 50},
+	}
+}
+
+// DefaultRecipes are the production actions of the tutorial
+func DefaultRecipes() []Recipe {
+	return []Recipe{
+		{Name: "cut wood", Outputs: []Ingredient{{WOOD, 1}}},
+		{Name: "build chair", Inputs: []Ingredient{{WOOD, 4}}, Outputs: []Ingredient{{CHAIR, 1}}},
+		{Name: "build bed", Inputs: []Ingredient{{WOOD, 2}, {FUR, 3}}, Outputs: []Ingredient{{BED, 1}}},
+	}
+}
+
+// NewCatalog checks the goods and recipes make sense and collects them for cities to use.
+// Leisure is always defined, a definition named leisure overrides its default
+func NewCatalog(definitions []GoodDefinition, newRecipes []Recipe) (*Catalog, error) {
+	newDefinitions := make(map[Good]GoodDefinition)
+	newGoods := make([]Good, 0, len(definitions))
+	for _, definition := range DefaultGoods() {
+		if definition.Name == LEISURE {
+			definition.Volatility = defaultVolatility
+			newDefinitions[LEISURE] = definition
+		}
+	}
+
+	for _, definition := range definitions {
+		if definition.Name == "" {
+			return nil, fmt.Errorf("good definition has no name")
+		}
+		if definition.HalfPersonalValueAt <= 0 {
+			return nil, fmt.Errorf("good %s needs a positive halfPersonalValueAt", definition.Name)
+		}
+		if definition.Volatility == 0 {
+			definition.Volatility = defaultVolatility
+		}
+		if definition.Name != LEISURE {
+			if _, exists := newDefinitions[definition.Name]; exists {
+				return nil, fmt.Errorf("good %s is defined twice", definition.Name)
+			}
+			newGoods = append(newGoods, definition.Name)
+		}
+		newDefinitions[definition.Name] = definition
+	}
+
+	if len(newGoods) == 0 {
+		return nil, fmt.Errorf("need at least one good to trade")
+	}
+
+	for _, recipe := range newRecipes {
+		if len(recipe.Outputs) == 0 {
+			return nil, fmt.Errorf("recipe %s makes nothing", recipe.Name)
+		}
+		for _, ingredient := range append(append([]Ingredient{}, recipe.Inputs...), recipe.Outputs...) {
+			if _, ok := newDefinitions[ingredient.Good]; !ok || ingredient.Good == LEISURE {
+				return nil, fmt.Errorf("recipe %s uses unknown good %s", recipe.Name, ingredient.Good)
+			}
+			if ingredient.Count <= 0 {
+				return nil, fmt.Errorf("recipe %s needs a positive count of %s", recipe.Name, ingredient.Good)
+			}
+		}
+	}
+
+	return &Catalog{
+		goods:       newGoods,
+		definitions: newDefinitions,
+		recipes:     append([]Recipe{}, newRecipes...),
+	}, nil
+}
+
+// Goods returns all the goods that can be traded
+func (catalog *Catalog) Goods() []Good {
+	return append([]Good{}, catalog.goods...)
+}
+
+// Recipes returns the production actions locals can take
+func (catalog *Catalog) Recipes() []Recipe {
+	return append([]Recipe{}, catalog.recipes...)
+}
+
+// Definitions returns the definition of every good, leisure last
+func (catalog *Catalog) Definitions() []GoodDefinition {
+	definitions := make([]GoodDefinition, 0, len(catalog.definitions))
+	for _, good := range append(catalog.Goods(), LEISURE) {
+		definitions = append(definitions, catalog.definitions[good])
+	}
+	return definitions
+}
+
+// true for the goods that can be traded, leisure isn't one
+func (catalog *Catalog) tradable(good Good) bool {
+	_, ok := catalog.definitions[good]
+	return ok && good != LEISURE
+}
+
+func (catalog *Catalog) recipe(name string) (Recipe, bool) {
+	for _, recipe := range catalog.recipes {
+		if recipe.Name == name {
+			return recipe, true
+		}
+	}
+	return Recipe{}, false
+}
+
+// the good merchants deal in when they are created
+func (catalog *Catalog) merchantGood() Good {
+	if catalog.tradable(FUR) {
+		return FUR
+	}
+	return catalog.goods[0]
+}
+
+// agents without personal values move their beliefs as much as the average local would
+func (catalog *Catalog) meanVolatility(good Good) float64 {
+	definition := catalog.definitions[good]
+	return (definition.BasePersonalValue + definition.BasePersonalValueSpread/2) * definition.Volatility
+}
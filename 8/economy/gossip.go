@@ -0,0 +1,150 @@
+package economy
+
+import (
+	"fmt"
+)
+
+// GossipPolicy decides how often a city tells the cities it is connected to what things cost there, how quickly and how accurately that news travels,
+// and how much the merchants in the city believe the news they hear. News travels separately from merchants, along the same travel ways
+type GossipPolicy struct {
+	Interval int     `json:"interval,omitempty"` // ticks between bulletins, 0 never sends any
+	Delay    int     `json:"delay,omitempty"`    // ticks a bulletin takes to reach the other cities
+	Noise    float64 `json:"noise,omitempty"`    // each price in a bulletin is off by this fraction on average, normally distributed
+	Trust    float64 `json:"trust,omitempty"`    // how far merchants here move their expected prices towards what a bulletin says, 0 ignores bulletins
+}
+
+// Validate checks the policy makes sense
+func (policy GossipPolicy) Validate() error {
+	if policy.Interval < 0 || policy.Delay < 0 {
+		return fmt.Errorf("gossip interval and delay can't be negative")
+	}
+	if policy.Noise < 0 {
+		return fmt.Errorf("gossip noise can't be negative")
+	}
+	if policy.Trust < 0 || policy.Trust > 1 {
+		return fmt.Errorf("gossip trust must be between 0 and 1")
+	}
+	return nil
+}
+
+// what a city thought things cost when it sent the bulletin
+type priceBulletin struct {
+	City   cityName         `json:"city"`
+	Tick   int              `json:"tick"` // when it was written
+	Due    int              `json:"due"`  // when it is sent on
+	Prices map[Good]float64 `json:"prices"`
+}
+
+// SetGossipPolicy starts the city sending price bulletins and its merchants listening to them, or changes how they do
+func (city *City) SetGossipPolicy(policy GossipPolicy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	city.gossip = &policy
+	return nil
+}
+
+// GossipPolicy returns the city's gossip policy, false if it sends no bulletins and ignores the ones it gets
+func (city *City) GossipPolicy() (GossipPolicy, bool) {
+	if city.gossip == nil {
+		return GossipPolicy{}, false
+	}
+	return *city.gossip, true
+}
+
+// BulletinsHeard returns how many price bulletins the city's merchants listened to during the last tick
+func (city *City) BulletinsHeard() int {
+	return city.lastBulletinsHeard
+}
+
+// what everyone in the city expects each good to cost, with noise added for the bulletin
+func (city *City) writeBulletin() priceBulletin {
+	bulletin := priceBulletin{
+		City:   city.name,
+		Tick:   city.tick,
+		Due:    city.tick + city.gossip.Delay,
+		Prices: make(map[Good]float64),
+	}
+	agents := city.allEconomicAgents()
+	for _, good := range city.catalog.goods {
+		total, believers := 0.0, 0
+		for _, agent := range agents {
+			if expected, ok := agent.gossip(good); ok {
+				total += expected
+				believers++
+			}
+		}
+		if believers == 0 {
+			continue
+		}
+		price := total / float64(believers)
+		if city.gossip.Noise > 0 {
+			price *= 1 + city.gossip.Noise*city.rng.NormFloat64()
+		}
+		if price < 0 {
+			price = 0
+		}
+		bulletin.Prices[good] = price
+	}
+	return bulletin
+}
+
+// merchants here update what they expect things cost in the city the bulletin came from
+func (city *City) hear(bulletin priceBulletin) {
+	for _, merchant := range city.merchants {
+		for good, price := range bulletin.Prices {
+			expected, known := merchant.ExpectedPrices[good]
+			if !known {
+				continue
+			}
+			if _, heardBefore := expected[bulletin.City]; !heardBefore {
+				expected[bulletin.City] = price // better than nothing
+			} else {
+				expected[bulletin.City] += city.gossip.Trust * (price - expected[bulletin.City])
+			}
+		}
+	}
+}
+
+// listen to the bulletins that arrived, then write a new one and send on the ones that are due
+func (city *City) spreadGossip() {
+	// bulletins are always taken off the travel ways, even by cities that don't listen, so they don't pile up
+	heard := 0
+	city.inboundGossip.Range(func(_ cityName, channel chan priceBulletin) bool {
+		for {
+			select {
+			case bulletin := <-channel:
+				if city.gossip != nil && city.gossip.Trust > 0 {
+					city.hear(bulletin)
+					heard++
+				}
+			default:
+				return true
+			}
+		}
+	})
+	city.lastBulletinsHeard = heard
+
+	if city.gossip == nil {
+		return
+	}
+	if city.gossip.Interval > 0 && city.tick%city.gossip.Interval == 0 {
+		city.bulletins = append(city.bulletins, city.writeBulletin())
+	}
+
+	waiting := city.bulletins[:0]
+	for _, bulletin := range city.bulletins {
+		if bulletin.Due > city.tick {
+			waiting = append(waiting, bulletin)
+			continue
+		}
+		city.outboundGossip.Range(func(_ cityName, channel chan priceBulletin) bool {
+			select {
+			case channel <- bulletin:
+			default: // nobody is reading them, news is cheap to lose
+			}
+			return true
+		})
+	}
+	city.bulletins = waiting
+}
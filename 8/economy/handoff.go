@@ -0,0 +1,214 @@
+package economy
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// how long merchants sent to a city that hung up wait for it to reconnect before they come back home
+var returnAfter = time.Minute
+
+// tells apart the transfers of this run from those of earlier runs, whose counters started from the same place
+var transferNonce = newTransferNonce()
+
+func newTransferNonce() string {
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(nonce)
+}
+
+// how many accepted transfers a city remembers, resent merchants older than this would be let in twice
+const rememberedTransfers = 10000
+
+// a merchant sent to another city, kept until the city acknowledges them
+type transfer struct {
+	ID       string    `json:"id"`
+	Merchant *Merchant `json:"merchant"`
+}
+
+type ackMessage struct {
+	ID string `json:"id"`
+}
+
+// keep a merchant until the city they are going to says they arrived
+func (travelWays *networkedTravelWays) addPending(to cityName, merchant *Merchant) transfer {
+	travelWays.mutex.Lock()
+	defer travelWays.mutex.Unlock()
+	return travelWays.recordPending(to, merchant)
+}
+
+// a merchant got on a travel way. Those on a connection's travel way are counted until they are picked up to be sent,
+// so Close can't miss one that was taken off the travel way but isn't pending yet
+func (travelWays *networkedTravelWays) settingOff(outboundChannel chan *Merchant) {
+	travelWays.mutex.Lock()
+	defer travelWays.mutex.Unlock()
+	if _, ok := travelWays.onTheWay[outboundChannel]; ok {
+		travelWays.onTheWay[outboundChannel]++
+	}
+}
+
+// a merchant taken off a connection's travel way stops being on the way and starts waiting for an answer in one go
+func (travelWays *networkedTravelWays) pickUp(to cityName, outboundChannel chan *Merchant, merchant *Merchant) transfer {
+	travelWays.mutex.Lock()
+	defer travelWays.mutex.Unlock()
+	if travelWays.onTheWay[outboundChannel] > 0 {
+		travelWays.onTheWay[outboundChannel]--
+	}
+	return travelWays.recordPending(to, merchant)
+}
+
+// must hold the mutex
+func (travelWays *networkedTravelWays) recordPending(to cityName, merchant *Merchant) transfer {
+	travelWays.nextTransfer++
+	sent := transfer{
+		ID:       fmt.Sprintf("%s/%s/%s/%d", travelWays.city.name, transferNonce, merchant.ID, travelWays.nextTransfer),
+		Merchant: merchant,
+	}
+	travelWays.pending[to] = append(travelWays.pending[to], sent)
+	return sent
+}
+
+// merchants sent to a city and not acknowledged yet, in the order they were sent
+func (travelWays *networkedTravelWays) pendingTo(to cityName) []transfer {
+	travelWays.mutex.Lock()
+	defer travelWays.mutex.Unlock()
+	return append([]transfer{}, travelWays.pending[to]...)
+}
+
+// the city got the merchant, we can forget about them
+func (travelWays *networkedTravelWays) acknowledge(from cityName, id string) {
+	travelWays.mutex.Lock()
+	defer travelWays.mutex.Unlock()
+	travelWays.forget(from, id)
+}
+
+// the city won't ever let the merchant in, so they come back home
+func (travelWays *networkedTravelWays) refused(from cityName, id string) {
+	travelWays.mutex.Lock()
+	defer travelWays.mutex.Unlock()
+	if merchant := travelWays.forget(from, id); merchant != nil {
+		travelWays.returned = append(travelWays.returned, merchant)
+	}
+}
+
+// stop waiting to hear about a transfer, returning its merchant, nil if we weren't waiting. Must hold the mutex
+func (travelWays *networkedTravelWays) forget(to cityName, id string) *Merchant {
+	var merchant *Merchant
+	pending := travelWays.pending[to]
+	for i, sent := range pending {
+		if sent.ID == id {
+			merchant = sent.Merchant
+			travelWays.pending[to] = append(pending[:i], pending[i+1:]...)
+			break
+		}
+	}
+	if len(travelWays.pending[to]) == 0 {
+		delete(travelWays.pending, to)
+	}
+	return merchant
+}
+
+// decides what to do with a merchant sent to us. Returns whether to let them in and whether to acknowledge them,
+// a merchant we already let in is only acknowledged again, and once the city is leaving the network new merchants are refused.
+// A refused transfer is remembered too, so a resent copy can't sneak in after the sender took the merchant back
+func (travelWays *networkedTravelWays) accept(id string) (letIn bool, acknowledge bool) {
+	travelWays.mutex.Lock()
+	defer travelWays.mutex.Unlock()
+
+	if accepted, seen := travelWays.received[id]; seen {
+		return false, accepted
+	}
+	travelWays.received[id] = !travelWays.closed
+	travelWays.receivedOrder = append(travelWays.receivedOrder, id)
+	if len(travelWays.receivedOrder) > rememberedTransfers {
+		delete(travelWays.received, travelWays.receivedOrder[0])
+		travelWays.receivedOrder = travelWays.receivedOrder[1:]
+	}
+	return !travelWays.closed, !travelWays.closed
+}
+
+// the connection to a city closed. Merchants it hasn't acknowledged stay pending and are resent if it reconnects within returnAfter,
+// only the city can say whether it let them in. Merchants still on the travel way never left, they come home
+func (travelWays *networkedTravelWays) disconnected(to cityName, outboundChannel chan *Merchant) {
+	travelWays.mutex.Lock()
+	defer travelWays.mutex.Unlock()
+	delete(travelWays.connected, to)
+	delete(travelWays.onTheWay, outboundChannel) // they are drained with the abandoned travel way instead
+	travelWays.abandoned = append(travelWays.abandoned, outboundChannel)
+	travelWays.disconnects[to]++
+	disconnect := travelWays.disconnects[to]
+	time.AfterFunc(returnAfter, func() {
+		travelWays.giveUpOn(to, disconnect)
+	})
+}
+
+// the city didn't come back after hanging up, merchants waiting to hear from it come home and are never resent.
+// One it let in whose acknowledgement got lost is now in both cities, the alternative is their money leaving the economy for good
+func (travelWays *networkedTravelWays) giveUpOn(to cityName, disconnect int) {
+	travelWays.mutex.Lock()
+	defer travelWays.mutex.Unlock()
+	if travelWays.connected[to] != nil || travelWays.disconnects[to] != disconnect {
+		return // it came back, and may have left again since
+	}
+	for _, sent := range travelWays.pending[to] {
+		travelWays.returned = append(travelWays.returned, sent.Merchant)
+	}
+	delete(travelWays.pending, to)
+}
+
+// merchants who entered the travel way but were never picked up
+func drain(outboundChannel chan *Merchant) []*Merchant {
+	merchants := make([]*Merchant, 0)
+	for {
+		select {
+		case merchant := <-outboundChannel:
+			merchants = append(merchants, merchant)
+		default:
+			return merchants
+		}
+	}
+}
+
+// merchants whose journey failed, they are handed back to the city once. Must be called by the city's own routine,
+// the only one setting off on its travel ways, so nobody can still be getting on a closed travel way once it is drained
+func (travelWays *networkedTravelWays) takeReturned() []*Merchant {
+	travelWays.mutex.Lock()
+	defer travelWays.mutex.Unlock()
+	returned := travelWays.returned
+	for _, outboundChannel := range travelWays.abandoned {
+		returned = append(returned, drain(outboundChannel)...)
+	}
+	travelWays.returned = nil
+	travelWays.abandoned = nil
+	return returned
+}
+
+// merchants that made it here but were still on the travel way when the connection closed, they were acknowledged so they must be let in
+func (travelWays *networkedTravelWays) strand(inboundChannel chan *Merchant) {
+	stranded := drain(inboundChannel)
+
+	travelWays.mutex.Lock()
+	defer travelWays.mutex.Unlock()
+	travelWays.stranded = append(travelWays.stranded, stranded...)
+}
+
+func (travelWays *networkedTravelWays) takeStranded() []*Merchant {
+	travelWays.mutex.Lock()
+	defer travelWays.mutex.Unlock()
+	stranded := travelWays.stranded
+	travelWays.stranded = nil
+	return stranded
+}
+
+// a merchant who never made it to another city comes back, they never left as far as the city is concerned
+func (city *City) welcomeBack(merchant *Merchant) {
+	merchant.city = city.name
+	merchant.TransitTicks = 0
+	merchant.Plan = nil
+	city.merchants = append(city.merchants, merchant)
+	city.syncAccount(merchant)
+}
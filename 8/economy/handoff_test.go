@@ -0,0 +1,205 @@
+package economy
+
+import (
+	"encoding/json"
+	"image/color"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// the city's end of a connection to B handled by its travel ways, and B's end for the test to talk through
+func connectTestPeer(t *testing.T, city *City) (*networkedTravelWays, *peer, chan *Merchant) {
+	t.Helper()
+	travelWays := newNetworkedTravelWays(city, nil)
+	connection, other := net.Pipe()
+	inbound := make(chan *Merchant, 100)
+	done := make(chan bool, 1)
+	go travelWays.handleIncomingMessages(newTestPeer(connection, "B"), inbound, make(chan priceBulletin, 100), done)
+	t.Cleanup(func() {
+		connection.Close()
+		other.Close()
+		<-done
+	})
+	return travelWays, newTestPeer(other, city.name), inbound
+}
+
+// the answer the city gave to a merchant we sent, ack or refused
+func answer(t *testing.T, remote *peer) (string, string) {
+	t.Helper()
+	remote.connection.SetReadDeadline(time.Now().Add(time.Second))
+	message, err := remote.receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ack := ackMessage{}
+	if err := json.Unmarshal(message.Body, &ack); err != nil {
+		t.Fatal(err)
+	}
+	return message.Type, ack.ID
+}
+
+func TestResentMerchantIsOnlyLetInOnce(t *testing.T) {
+	city := NewCity("A", color.White, 0, 1)
+	_, remote, inbound := connectTestPeer(t, city)
+
+	sent := transfer{ID: "B/nonce/B-merchant-1/1", Merchant: &Merchant{ID: "B-merchant-1"}}
+	for i := 0; i < 3; i++ { // our acknowledgement got lost, so B keeps resending
+		if err := remote.send(messageMerchant, sent); err != nil {
+			t.Fatal(err)
+		}
+		if kind, id := answer(t, remote); kind != messageAck || id != sent.ID {
+			t.Fatalf("answered %s %s, expected an ack for %s", kind, id, sent.ID)
+		}
+	}
+	if len(inbound) != 1 {
+		t.Errorf("%d merchants came in, expected exactly 1", len(inbound))
+	}
+}
+
+func TestLeavingCityRefusesNewMerchants(t *testing.T) {
+	city := NewCity("A", color.White, 0, 1)
+	travelWays, remote, inbound := connectTestPeer(t, city)
+
+	before := transfer{ID: "B/nonce/B-merchant-1/1", Merchant: &Merchant{ID: "B-merchant-1"}}
+	remote.send(messageMerchant, before)
+	answer(t, remote)
+
+	travelWays.mutex.Lock()
+	travelWays.closed = true
+	travelWays.mutex.Unlock()
+
+	after := transfer{ID: "B/nonce/B-merchant-2/2", Merchant: &Merchant{ID: "B-merchant-2"}}
+	for i := 0; i < 2; i++ { // refused once means refused for good
+		remote.send(messageMerchant, after)
+		if kind, id := answer(t, remote); kind != messageRefused || id != after.ID {
+			t.Fatalf("answered %s %s, expected %s to be refused", kind, id, after.ID)
+		}
+	}
+	// a merchant let in before is still acknowledged, they can't be refused anymore
+	remote.send(messageMerchant, before)
+	if kind, _ := answer(t, remote); kind != messageAck {
+		t.Errorf("answered %s to a merchant already let in, expected an ack", kind)
+	}
+	if len(inbound) != 1 {
+		t.Errorf("%d merchants came in, expected only the one sent before leaving", len(inbound))
+	}
+}
+
+func TestOnlyRefusedMerchantsComeHome(t *testing.T) {
+	city := NewCity("A", color.White, 0, 1)
+	travelWays, remote, _ := connectTestPeer(t, city)
+
+	acknowledged := travelWays.addPending("B", &Merchant{ID: "A-merchant-1"})
+	refused := travelWays.addPending("B", &Merchant{ID: "A-merchant-2"})
+	unanswered := travelWays.addPending("B", &Merchant{ID: "A-merchant-3"})
+	if !strings.Contains(acknowledged.ID, transferNonce) {
+		t.Errorf("transfer %s doesn't say which run sent it", acknowledged.ID)
+	}
+	if acknowledged.ID == refused.ID {
+		t.Fatal("two transfers have the same id")
+	}
+
+	remote.send(messageAck, ackMessage{ID: acknowledged.ID})
+	remote.send(messageRefused, ackMessage{ID: refused.ID})
+	remote.send(messageRefused, ackMessage{ID: "B/unknown/1"}) // never sent, nothing comes back
+	remote.send(messagePing, struct{}{})
+	remote.receive() // the pong, every message before it has been handled
+
+	returned := travelWays.takeReturned()
+	if len(returned) != 1 || returned[0] != refused.Merchant {
+		t.Errorf("%v came home, expected only the refused merchant", returned)
+	}
+	pending := travelWays.pendingTo("B")
+	if len(pending) != 1 || pending[0].ID != unanswered.ID {
+		t.Errorf("%v are still pending, expected only the unanswered merchant", pending)
+	}
+}
+
+func TestDisconnectKeepsUnansweredMerchants(t *testing.T) {
+	city := NewCity("A", color.White, 0, 1)
+	travelWays := newNetworkedTravelWays(city, nil)
+	travelWays.connected["B"] = &peer{}
+
+	sent := travelWays.addPending("B", &Merchant{ID: "A-merchant-1"})
+	outbound := make(chan *Merchant, 10)
+	neverLeft := &Merchant{ID: "A-merchant-2"}
+	outbound <- neverLeft
+	if travelWays.handedOff() {
+		t.Error("handed off while a connected city hasn't answered")
+	}
+
+	travelWays.disconnected("B", outbound)
+	if pending := travelWays.pendingTo("B"); len(pending) != 1 || pending[0].ID != sent.ID {
+		t.Errorf("%v are pending, the sent merchant should wait for B to come back", pending)
+	}
+	if returned := travelWays.takeReturned(); len(returned) != 1 || returned[0] != neverLeft {
+		t.Errorf("%v came home, expected only the merchant still on the travel way", returned)
+	}
+	if !travelWays.handedOff() {
+		t.Error("waiting on a city that hung up")
+	}
+}
+
+func merchantMoney(city *City) float64 {
+	money := 0.0
+	for _, merchant := range city.merchants {
+		money += merchant.Money
+	}
+	return money
+}
+
+func TestMerchantsComeHomeIfTheCityNeverReconnects(t *testing.T) {
+	defer func(wait time.Duration) { returnAfter = wait }(returnAfter)
+	returnAfter = 10 * time.Millisecond
+
+	city := NewCity("A", color.White, 4, 1)
+	travelWays := newNetworkedTravelWays(city, nil)
+	travelWays.connected["B"] = &peer{}
+	money, merchants := merchantMoney(city), len(city.merchants)
+
+	for _, merchant := range append([]*Merchant{}, city.merchants...) {
+		city.removeMerchant(merchant)
+		travelWays.addPending("B", merchant)
+	}
+	travelWays.disconnected("B", make(chan *Merchant, 10))
+
+	returned := make([]*Merchant, 0)
+	waitFor(t, "the merchants to come home", func() bool {
+		returned = append(returned, travelWays.takeReturned()...)
+		return len(returned) == merchants
+	})
+	for _, merchant := range returned {
+		city.welcomeBack(merchant)
+	}
+	if got := merchantMoney(city); got != money {
+		t.Errorf("the merchants have %.2f, they left with %.2f", got, money)
+	}
+	if pending := travelWays.pendingTo("B"); len(pending) != 0 {
+		t.Errorf("%v are still pending, they would be resent after coming home", pending)
+	}
+}
+
+func TestMerchantsWaitForACityThatReconnects(t *testing.T) {
+	defer func(wait time.Duration) { returnAfter = wait }(returnAfter)
+	returnAfter = 10 * time.Millisecond
+
+	city := NewCity("A", color.White, 0, 1)
+	travelWays := newNetworkedTravelWays(city, nil)
+	travelWays.connected["B"] = &peer{}
+	sent := travelWays.addPending("B", &Merchant{ID: "A-merchant-1"})
+
+	travelWays.disconnected("B", make(chan *Merchant, 10))
+	travelWays.mutex.Lock()
+	travelWays.connected["B"] = &peer{} // back before anyone gave up on it
+	travelWays.mutex.Unlock()
+	time.Sleep(10 * returnAfter)
+
+	if returned := travelWays.takeReturned(); len(returned) != 0 {
+		t.Errorf("%v came home although B came back", returned)
+	}
+	if pending := travelWays.pendingTo("B"); len(pending) != 1 || pending[0].ID != sent.ID {
+		t.Errorf("%v are pending, expected the sent merchant to wait for B's answer", pending)
+	}
+}
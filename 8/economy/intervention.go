@@ -0,0 +1,377 @@
+package economy
+
+import (
+	"fmt"
+)
+
+// Intervention is a change made to a city from outside the economy, such as a policy or a disaster
+type Intervention interface {
+	Apply(city *City) error
+	String() string
+}
+
+// an intervention that can tell before it is scheduled whether the city will refuse it
+type checkedIntervention interface {
+	check(city *City) error
+}
+
+// AppliedIntervention records when and where an intervention happened
+type AppliedIntervention struct {
+	Tick         int
+	City         string
+	Intervention Intervention
+}
+
+func (applied AppliedIntervention) String() string {
+	return fmt.Sprintf("tick %d, %s: %s", applied.Tick, applied.City, applied.Intervention)
+}
+
+// Influence applies an intervention to a city right away and logs it. An intervention the city refuses isn't logged
+func (simulation *Simulation) Influence(location string, intervention Intervention) error {
+	city, ok := simulation.City(location)
+	if !ok {
+		return fmt.Errorf("unknown city %s", location)
+	}
+	if err := intervention.Apply(city); err != nil {
+		return fmt.Errorf("%s: %w", intervention, err)
+	}
+	simulation.interventions = append(simulation.interventions, AppliedIntervention{
+		Tick:         simulation.tick,
+		City:         location,
+		Intervention: intervention,
+	})
+	return nil
+}
+
+// InfluenceAt applies an intervention to a city at the start of a tick. Interventions that can tell they will be refused,
+// such as invalid policies, are refused right away. Any other refusal only shows when the tick comes, it is printed and not logged
+func (simulation *Simulation) InfluenceAt(tick int, location string, intervention Intervention) error {
+	city, ok := simulation.City(location)
+	if !ok {
+		return fmt.Errorf("unknown city %s", location)
+	}
+	if checked, ok := intervention.(checkedIntervention); ok {
+		if err := checked.check(city); err != nil {
+			return fmt.Errorf("%s: %w", intervention, err)
+		}
+	}
+	simulation.At(tick, func(simulation *Simulation) {
+		if err := simulation.Influence(location, intervention); err != nil {
+			fmt.Printf("tick %d, %s refused an intervention: %v\n", simulation.tick, location, err)
+		}
+	})
+	return nil
+}
+
+// Interventions returns every intervention applied so far, oldest first
+func (simulation *Simulation) Interventions() []AppliedIntervention {
+	return simulation.interventions
+}
+
+// MoneyInjection gives every local the same amount of money
+type MoneyInjection struct {
+	PerLocal float64
+}
+
+// Apply implements Intervention
+func (injection MoneyInjection) Apply(city *City) error {
+	city.GrantMoney(injection.PerLocal)
+	return nil
+}
+
+func (injection MoneyInjection) String() string {
+	return fmt.Sprintf("gave every local %.2f", injection.PerLocal)
+}
+
+// HelicopterDrop scatters money randomly amongst the locals, some get a lot and some get nothing
+type HelicopterDrop struct {
+	Total float64
+	Drops int // how many bundles the money is split into, defaults to one per local
+}
+
+// Apply implements Intervention
+func (drop HelicopterDrop) Apply(city *City) error {
+	if len(city.locals) == 0 {
+		return fmt.Errorf("nobody lives there")
+	}
+	drops := drop.Drops
+	if drops <= 0 {
+		drops = len(city.locals)
+	}
+	for i := 0; i < drops; i++ {
+		city.locals[city.rng.Intn(len(city.locals))].money += drop.Total / float64(drops)
+	}
+	return nil
+}
+
+func (drop HelicopterDrop) String() string {
+	return fmt.Sprintf("dropped %.2f from a helicopter", drop.Total)
+}
+
+// SupplyShock adds (or with negative Units, destroys) units of a good, one at a time from randomly chosen locals
+type SupplyShock struct {
+	Good  Good
+	Units int
+}
+
+// Apply implements Intervention
+func (shock SupplyShock) Apply(city *City) error {
+	if _, ok := city.catalog.definitions[shock.Good]; !ok {
+		return fmt.Errorf("the city doesn't have %s", shock.Good)
+	}
+	if len(city.locals) == 0 {
+		return fmt.Errorf("nobody lives there")
+	}
+
+	if shock.Units >= 0 {
+		for i := 0; i < shock.Units; i++ {
+			city.locals[city.rng.Intn(len(city.locals))].markets[shock.Good].ownedGoods++
+		}
+		return nil
+	}
+
+	// only destroy from people who have some, stop if nobody does
+	for i := 0; i < -shock.Units; i++ {
+		owners := make([]*Local, 0)
+		for _, local := range city.locals {
+			if local.markets[shock.Good].ownedGoods > 0 {
+				owners = append(owners, local)
+			}
+		}
+		if len(owners) == 0 {
+			return nil
+		}
+		owners[city.rng.Intn(len(owners))].markets[shock.Good].ownedGoods--
+	}
+	return nil
+}
+
+func (shock SupplyShock) String() string {
+	if shock.Units < 0 {
+		return fmt.Sprintf("destroyed %d %s", -shock.Units, shock.Good)
+	}
+	return fmt.Sprintf("added %d %s", shock.Units, shock.Good)
+}
+
+// PreferenceShift changes how much every local values a good by multiplying their base personal value
+type PreferenceShift struct {
+	Good   Good
+	Factor float64
+}
+
+// Apply implements Intervention
+func (shift PreferenceShift) Apply(city *City) error {
+	for _, local := range city.locals {
+		if market, ok := local.markets[shift.Good]; ok {
+			market.basePersonalValue *= shift.Factor
+		}
+	}
+	return nil
+}
+
+func (shift PreferenceShift) String() string {
+	return fmt.Sprintf("%s is valued %.2f times as much", shift.Good, shift.Factor)
+}
+
+// TravelCostChange sets the cost of travelling from the city to another
+type TravelCostChange struct {
+	To   string
+	Cost float64
+}
+
+// Apply implements Intervention
+func (change TravelCostChange) Apply(city *City) error {
+	city.SetTravelCost(change.To, change.Cost)
+	return nil
+}
+
+func (change TravelCostChange) String() string {
+	return fmt.Sprintf("travel to %s costs %.2f", change.To, change.Cost)
+}
+
+// DistanceChange sets the length of the travel way from the city to another, like a new road or a washed out bridge
+type DistanceChange struct {
+	To       string
+	Distance float64
+}
+
+// Apply implements Intervention
+func (change DistanceChange) Apply(city *City) error {
+	return city.SetDistance(change.To, change.Distance)
+}
+
+func (change DistanceChange) check(city *City) error {
+	if change.Distance < 0 {
+		return fmt.Errorf("distance to %s can't be negative", change.To)
+	}
+	return nil
+}
+
+func (change DistanceChange) String() string {
+	return fmt.Sprintf("%s is %.2f away", change.To, change.Distance)
+}
+
+// MerchantTaxChange sets the toll arriving merchants pay on their money above the threshold
+type MerchantTaxChange struct {
+	Threshold float64
+	Rate      float64
+}
+
+// Apply implements Intervention
+func (change MerchantTaxChange) Apply(city *City) error {
+	policy := city.taxPolicy
+	policy.EntryTollBrackets = TaxBrackets{{Above: change.Threshold, Rate: change.Rate}}
+	return city.SetTaxPolicy(policy)
+}
+
+func (change MerchantTaxChange) check(city *City) error {
+	return TaxBrackets{{Above: change.Threshold, Rate: change.Rate}}.Validate()
+}
+
+func (change MerchantTaxChange) String() string {
+	return fmt.Sprintf("merchants pay %.0f%% tax above %.2f", change.Rate*100, change.Threshold)
+}
+
+// TaxPolicyChange replaces the city's tax policy, the city refuses invalid policies
+type TaxPolicyChange struct {
+	Policy TaxPolicy
+}
+
+// Apply implements Intervention
+func (change TaxPolicyChange) Apply(city *City) error {
+	return city.SetTaxPolicy(change.Policy)
+}
+
+func (change TaxPolicyChange) check(city *City) error {
+	return change.Policy.Validate()
+}
+
+func (change TaxPolicyChange) String() string {
+	return "changed the tax policy"
+}
+
+// BankPolicyChange opens a bank in the city or changes the policy of the one there, the city refuses invalid policies
+type BankPolicyChange struct {
+	Policy BankPolicy
+}
+
+// Apply implements Intervention
+func (change BankPolicyChange) Apply(city *City) error {
+	return city.SetBankPolicy(change.Policy)
+}
+
+func (change BankPolicyChange) check(city *City) error {
+	return change.Policy.Validate()
+}
+
+func (change BankPolicyChange) String() string {
+	return fmt.Sprintf("bank lends at %.2f%% per tick", change.Policy.LoanRate*100)
+}
+
+// MonetaryPolicyChange opens a central bank in the city or changes the policy of the one there, the city refuses invalid policies
+type MonetaryPolicyChange struct {
+	Policy MonetaryPolicy
+}
+
+// Apply implements Intervention
+func (change MonetaryPolicyChange) Apply(city *City) error {
+	return city.SetMonetaryPolicy(change.Policy)
+}
+
+func (change MonetaryPolicyChange) check(city *City) error {
+	return change.Policy.Validate(city.catalog)
+}
+
+func (change MonetaryPolicyChange) String() string {
+	return fmt.Sprintf("central bank follows the %s rule", change.Policy.Rule)
+}
+
+// DemographyPolicyChange changes how locals are born, die and move away, the city refuses invalid policies
+type DemographyPolicyChange struct {
+	Policy DemographyPolicy
+}
+
+// Apply implements Intervention
+func (change DemographyPolicyChange) Apply(city *City) error {
+	return city.SetDemographyPolicy(change.Policy)
+}
+
+func (change DemographyPolicyChange) check(city *City) error {
+	return change.Policy.Validate()
+}
+
+func (change DemographyPolicyChange) String() string {
+	return fmt.Sprintf("%.2f%% births and %.2f%% deaths per tick", change.Policy.BirthRate*100, change.Policy.DeathRate*100)
+}
+
+// GossipPolicyChange changes how a city shares price bulletins and how much its merchants trust them, the city refuses invalid policies
+type GossipPolicyChange struct {
+	Policy GossipPolicy
+}
+
+// Apply implements Intervention
+func (change GossipPolicyChange) Apply(city *City) error {
+	return city.SetGossipPolicy(change.Policy)
+}
+
+func (change GossipPolicyChange) check(city *City) error {
+	return change.Policy.Validate()
+}
+
+func (change GossipPolicyChange) String() string {
+	return fmt.Sprintf("bulletins every %d ticks taking %d ticks, trusted %.0f%%", change.Policy.Interval, change.Policy.Delay, change.Policy.Trust*100)
+}
+
+// LaborMarketToggle opens or closes a city's labor market, closing it throws away every job offer
+type LaborMarketToggle struct {
+	Open bool
+}
+
+// Apply implements Intervention
+func (toggle LaborMarketToggle) Apply(city *City) error {
+	city.SetLaborMarket(toggle.Open)
+	return nil
+}
+
+func (toggle LaborMarketToggle) String() string {
+	if toggle.Open {
+		return "opened the labor market"
+	}
+	return "closed the labor market"
+}
+
+// Specialization turns a city's specialization on or off
+type Specialization struct {
+	Enabled bool
+}
+
+// Apply implements Intervention
+func (specialization Specialization) Apply(city *City) error {
+	city.SetSpecialized(specialization.Enabled)
+	return nil
+}
+
+func (specialization Specialization) String() string {
+	if specialization.Enabled {
+		return "specialized"
+	}
+	return "stopped specializing"
+}
+
+// LocalRemoval removes locals from the city, all of them if Count is not positive
+type LocalRemoval struct {
+	Count int
+}
+
+// Apply implements Intervention
+func (removal LocalRemoval) Apply(city *City) error {
+	city.RemoveLocals(removal.Count)
+	return nil
+}
+
+func (removal LocalRemoval) String() string {
+	if removal.Count <= 0 {
+		return "removed every local"
+	}
+	return fmt.Sprintf("removed %d locals", removal.Count)
+}
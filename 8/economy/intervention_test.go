@@ -0,0 +1,32 @@
+package economy
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestRefusedInterventionsAreNotLogged(t *testing.T) {
+	city := NewCity("First", color.White, 10, 1)
+	simulation := NewSimulation(city)
+
+	if err := simulation.Influence("First", TaxPolicyChange{Policy: TaxPolicy{IncomeTax: 2}}); err == nil {
+		t.Error("an income tax above 1 was applied")
+	}
+	if err := simulation.Influence("First", DistanceChange{To: "Second", Distance: -1}); err == nil {
+		t.Error("a negative distance was applied")
+	}
+	if err := simulation.InfluenceAt(5, "First", BankPolicyChange{Policy: BankPolicy{ReserveRatio: -1}}); err == nil {
+		t.Error("an invalid bank policy was scheduled")
+	}
+	simulation.Run(10)
+	if len(simulation.Interventions()) != 0 {
+		t.Errorf("refused interventions were logged: %v", simulation.Interventions())
+	}
+
+	if err := simulation.Influence("First", MoneyInjection{PerLocal: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if len(simulation.Interventions()) != 1 {
+		t.Errorf("expected the money injection to be logged, got %v", simulation.Interventions())
+	}
+}
@@ -0,0 +1,204 @@
+package economy
+
+import "math"
+
+// LaborReport is what happened in a city's labor market during a tick
+type LaborReport struct {
+	Hires       int     // jobs done for someone else
+	Employers   int     // locals who hired anyone
+	AverageWage float64 // the wage the market cleared at, 0 if nobody was hired
+	Unfilled    int     // offers that expired without anyone taking them
+}
+
+// a local offering to pay someone else to carry out one of their recipes
+type jobOffer struct {
+	employer *Local
+	recipe   int // index into the recipes of the catalog
+	wage     float64
+	placed   int // the round the offer was posted
+}
+
+// LaborMarket lets locals hire each other. An employer pays the wage and provides the inputs, and keeps the output
+type LaborMarket struct {
+	offers []*jobOffer
+
+	wages              float64 // paid during the current tick
+	employers          map[AgentID]bool
+	report, lastReport LaborReport
+}
+
+func newLaborMarket() *LaborMarket {
+	return &LaborMarket{
+		offers:    make([]*jobOffer, 0),
+		employers: make(map[AgentID]bool),
+	}
+}
+
+// SetLaborMarket opens or closes the city's labor market
+func (city *City) SetLaborMarket(open bool) {
+	if !open {
+		city.labor = nil
+	} else if city.labor == nil {
+		city.labor = newLaborMarket()
+	}
+}
+
+// LaborReport returns what happened in the labor market during the last tick, all 0 if the city has no labor market
+func (city *City) LaborReport() LaborReport {
+	if city.labor == nil {
+		return LaborReport{}
+	}
+	return city.labor.lastReport
+}
+
+// the best paid job someone could take right now, nil if there isn't one.
+// Offers that are no longer any good are thrown away, and their employers learn they need to pay more
+func (labor *LaborMarket) bestOffer(city *City, worker *Local) *jobOffer {
+	var best *jobOffer
+	kept := labor.offers[:0]
+	for _, offer := range labor.offers {
+		if !city.isPresent(offer.employer) {
+			continue
+		}
+		if city.round-offer.placed > orderLifetime {
+			offer.employer.expectedWage += offer.employer.markets[LEISURE].beliefVolatility
+			labor.report.Unfilled++
+			continue
+		}
+		if !labor.offerValid(city, offer) {
+			continue
+		}
+		kept = append(kept, offer)
+		if offer.employer != worker && (best == nil || offer.wage > best.wage) {
+			best = offer
+		}
+	}
+	labor.offers = kept
+	return best
+}
+
+func (labor *LaborMarket) offerValid(city *City, offer *jobOffer) bool {
+	if offer.recipe >= len(city.catalog.recipes) || offer.employer.money < offer.wage {
+		return false
+	}
+	for _, input := range city.catalog.recipes[offer.recipe].Inputs {
+		if offer.employer.markets[input.Good].ownedGoods <= input.Count {
+			return false
+		}
+	}
+	return true
+}
+
+// the worker does the job, the employer pays them and keeps what they made
+func (labor *LaborMarket) hire(city *City, offer *jobOffer, worker *Local) {
+	employer := offer.employer
+	recipe := city.catalog.recipes[offer.recipe]
+
+	employer.money -= offer.wage
+	worker.money += offer.wage
+	for _, input := range recipe.Inputs {
+		employer.markets[input.Good].ownedGoods -= input.Count
+	}
+	for _, output := range recipe.Outputs {
+		employer.markets[output.Good].ownedGoods += city.harvest(output.Good, output.Count*city.productivity(output.Good))
+	}
+	worker.employer = employer.ID
+
+	// it was easy to find someone, so try paying less next time
+	employer.lowerWage()
+	labor.removeOffer(employer)
+
+	labor.report.Hires++
+	labor.wages += offer.wage
+	if !labor.employers[employer.ID] {
+		labor.employers[employer.ID] = true
+		labor.report.Employers++
+	}
+}
+
+// the employer offers a job if someone else doing their best recipe is worth more to them than the wage they expect to pay
+func (labor *LaborMarket) post(city *City, employer *Local) {
+	labor.removeOffer(employer)
+
+	bestRecipe, bestValue := -1, 0.0
+	for i, recipe := range city.catalog.recipes {
+		if value, possible := employer.recipeValue(recipe, city); possible && value > bestValue {
+			bestRecipe = i
+			bestValue = value
+		}
+	}
+	if bestRecipe < 0 {
+		return
+	}
+
+	wage := employer.expectedWage
+	if wage > employer.valueToPrice(bestValue) {
+		employer.lowerWage() // not worth it at that wage, maybe someone would work for less
+		return
+	}
+	if wage > employer.money {
+		return
+	}
+	labor.offers = append(labor.offers, &jobOffer{employer: employer, recipe: bestRecipe, wage: wage, placed: city.round})
+}
+
+// wages never go below the smallest step, or an employer could never hire again
+func (local *Local) lowerWage() {
+	volatility := local.markets[LEISURE].beliefVolatility
+	local.expectedWage = math.Max(local.expectedWage-volatility, volatility)
+}
+
+func (labor *LaborMarket) removeOffer(employer *Local) {
+	for i, offer := range labor.offers {
+		if offer.employer == employer {
+			labor.offers = append(labor.offers[:i], labor.offers[i+1:]...)
+			return
+		}
+	}
+}
+
+// start a new report, called at the end of every tick
+func (labor *LaborMarket) rotate() {
+	if labor.report.Hires > 0 {
+		labor.report.AverageWage = labor.wages / float64(labor.report.Hires)
+	}
+	labor.lastReport = labor.report
+	labor.report = LaborReport{}
+	labor.wages = 0
+	labor.employers = make(map[AgentID]bool)
+}
+
+// what is needed to save and restore the labor market between ticks, employers are saved by id
+type laborState struct {
+	Offers []jobOfferState `json:"offers"`
+	Report LaborReport     `json:"report"`
+}
+
+type jobOfferState struct {
+	Employer AgentID `json:"employer"`
+	Recipe   int     `json:"recipe"`
+	Wage     float64 `json:"wage"`
+	Placed   int     `json:"placed"`
+}
+
+func (labor *LaborMarket) save() *laborState {
+	state := &laborState{Offers: make([]jobOfferState, len(labor.offers)), Report: labor.lastReport}
+	for i, offer := range labor.offers {
+		state.Offers[i] = jobOfferState{Employer: offer.employer.ID, Recipe: offer.recipe, Wage: offer.wage, Placed: offer.placed}
+	}
+	return state
+}
+
+// offers from employers who are no longer in the city are dropped, nobody could take them anyway
+func (labor *LaborMarket) restore(state *laborState, locals []*Local) {
+	byID := make(map[AgentID]*Local)
+	for _, local := range locals {
+		byID[local.ID] = local
+	}
+	labor.lastReport = state.Report
+	for _, saved := range state.Offers {
+		if employer, ok := byID[saved.Employer]; ok {
+			labor.offers = append(labor.offers, &jobOffer{employer: employer, recipe: saved.Recipe, wage: saved.Wage, placed: saved.Placed})
+		}
+	}
+}
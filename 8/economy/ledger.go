@@ -0,0 +1,160 @@
+package economy
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+)
+
+// AgentID uniquely identifies an agent, even as they travel between cities
+type AgentID string
+
+// AgentKind says what sort of agent took part in a trade
+type AgentKind string
+
+// the kinds of agents in the economy
+const (
+	LocalAgent    AgentKind = "local"
+	MerchantAgent AgentKind = "merchant"
+	TraderAgent   AgentKind = "trader"
+	FirmAgent     AgentKind = "firm"
+)
+
+// Trade is a single unit of a good changing hands
+type Trade struct {
+	Tick       int
+	City       string
+	Good       Good
+	Buyer      AgentID
+	BuyerKind  AgentKind
+	Seller     AgentID
+	SellerKind AgentKind
+	Price      float64
+}
+
+// ProfitAndLoss sums up the trades of an agent
+type ProfitAndLoss struct {
+	Bought, Sold  int
+	Spent, Earned float64
+}
+
+// Net is how much money the agent made (or lost) from trading
+func (pnl ProfitAndLoss) Net() float64 {
+	return pnl.Earned - pnl.Spent
+}
+
+// Ledger records every trade made in a city
+type Ledger struct {
+	trades    []Trade
+	keepTicks int // 0 keeps everything
+}
+
+// NewLedger creates an empty ledger
+func NewLedger() *Ledger {
+	return &Ledger{}
+}
+
+// KeepLast makes the ledger forget trades older than the given number of ticks, 0 keeps everything
+func (ledger *Ledger) KeepLast(ticks int) {
+	ledger.keepTicks = ticks
+}
+
+func (ledger *Ledger) record(trade Trade) {
+	ledger.trades = append(ledger.trades, trade)
+
+	if ledger.keepTicks > 0 && ledger.trades[0].Tick <= trade.Tick-ledger.keepTicks {
+		oldest := trade.Tick - ledger.keepTicks
+		i := 0
+		for i < len(ledger.trades) && ledger.trades[i].Tick <= oldest {
+			i++
+		}
+		ledger.trades = append([]Trade{}, ledger.trades[i:]...)
+	}
+}
+
+// Trades returns every trade in the ledger, oldest first
+func (ledger *Ledger) Trades() []Trade {
+	return ledger.trades
+}
+
+// Between returns the trades made from tick from up to but not including tick to
+func (ledger *Ledger) Between(from, to int) []Trade {
+	trades := make([]Trade, 0)
+	for _, trade := range ledger.trades {
+		if trade.Tick >= from && trade.Tick < to {
+			trades = append(trades, trade)
+		}
+	}
+	return trades
+}
+
+// VolumeWeightedAveragePrice is the average price a good actually sold for between two ticks, false if it never sold
+func (ledger *Ledger) VolumeWeightedAveragePrice(good Good, from, to int) (float64, bool) {
+	total, volume := 0.0, 0
+	for _, trade := range ledger.Between(from, to) {
+		if trade.Good == good {
+			total += trade.Price // every trade is of a single unit
+			volume++
+		}
+	}
+	if volume == 0 {
+		return 0, false
+	}
+	return total / float64(volume), true
+}
+
+// TradeCounts is how many trades of each good were made between two ticks
+func (ledger *Ledger) TradeCounts(from, to int) map[Good]int {
+	counts := make(map[Good]int)
+	for _, trade := range ledger.Between(from, to) {
+		counts[trade.Good]++
+	}
+	return counts
+}
+
+// ProfitAndLoss sums the trades of every agent in the ledger
+func (ledger *Ledger) ProfitAndLoss() map[AgentID]ProfitAndLoss {
+	pnls := make(map[AgentID]ProfitAndLoss)
+	for _, trade := range ledger.trades {
+		buyer := pnls[trade.Buyer]
+		buyer.Bought++
+		buyer.Spent += trade.Price
+		pnls[trade.Buyer] = buyer
+
+		seller := pnls[trade.Seller]
+		seller.Sold++
+		seller.Earned += trade.Price
+		pnls[trade.Seller] = seller
+	}
+	return pnls
+}
+
+// WriteCSV writes every trade in the ledger as a row of a CSV file with a header
+func (ledger *Ledger) WriteCSV(writer io.Writer) error {
+	return WriteTradesCSV(writer, ledger.trades)
+}
+
+// WriteTradesCSV writes trades as rows of a CSV file with a header
+func WriteTradesCSV(writer io.Writer, trades []Trade) error {
+	csvWriter := csv.NewWriter(writer)
+	if err := csvWriter.Write([]string{"tick", "city", "good", "buyer", "buyer_kind", "seller", "seller_kind", "price"}); err != nil {
+		return err
+	}
+	for _, trade := range trades {
+		err := csvWriter.Write([]string{
+			strconv.Itoa(trade.Tick),
+			trade.City,
+			string(trade.Good),
+			string(trade.Buyer),
+			string(trade.BuyerKind),
+			string(trade.Seller),
+			string(trade.SellerKind),
+			strconv.FormatFloat(trade.Price, 'g', -1, 64),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
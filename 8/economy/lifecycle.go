@@ -0,0 +1,166 @@
+package economy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// how often connected cities ping each other, and how long one can stay quiet before it is taken for dead
+const (
+	heartbeatInterval = 5 * time.Second
+	peerTimeout       = 3 * heartbeatInterval
+)
+
+// how often Close checks whether every merchant has been handed over
+const handoffPoll = 10 * time.Millisecond
+
+// keep pinging the peer until the connection closes, so both sides notice if the other disappears
+func heartbeat(peer *peer, closing chan struct{}) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := peer.send(messagePing, struct{}{}); err != nil {
+				return
+			}
+		case <-closing:
+			return
+		}
+	}
+}
+
+// Close takes the city off the network. It stops accepting connections, waits for the merchants it sent to be let in,
+// tells its peers it is leaving and hangs up. Merchants a peer refused, or who never got on the connection, come back to the city.
+// Merchants no peer answered for stay where they are, they may already be in the other city and welcoming them back could duplicate them,
+// until returnAfter has passed since their city hung up.
+// Call it once the city has stopped updating. If ctx ends first the connections are cut anyway and ctx's error is returned,
+// merchants of connections that finish hanging up later, or whose city never came back, are taken in by calling Close again
+func (city *City) Close(ctx context.Context) error {
+	if city.networkPorts == nil {
+		return nil
+	}
+	travelWays := city.networkPorts
+
+	travelWays.mutex.Lock()
+	alreadyClosed := travelWays.closed
+	if !alreadyClosed {
+		travelWays.closed = true
+		close(travelWays.quit)
+	}
+	travelWays.mutex.Unlock()
+
+	var err error
+	if !alreadyClosed {
+		travelWays.server.Close()
+		err = travelWays.waitForHandoffs(ctx)
+		travelWays.hangUp(fmt.Sprintf("%s is leaving the network", city.name))
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		travelWays.handlers.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	for _, merchant := range travelWays.takeStranded() {
+		city.receiveMerchant(merchant)
+	}
+	for _, merchant := range travelWays.takeReturned() {
+		city.welcomeBack(merchant)
+	}
+	if unanswered := travelWays.unanswered(); err == nil && unanswered > 0 {
+		err = fmt.Errorf("%d merchants were sent but never acknowledged or refused", unanswered)
+	}
+	return err
+}
+
+// say goodbye, then hang up on everyone, including peers still saying hello
+func (travelWays *networkedTravelWays) hangUp(reason string) {
+	travelWays.mutex.Lock()
+	peers := make([]*peer, 0, len(travelWays.connected))
+	for _, peer := range travelWays.connected {
+		peers = append(peers, peer)
+	}
+	connections := make([]net.Conn, 0, len(travelWays.connections))
+	for connection := range travelWays.connections {
+		connections = append(connections, connection)
+	}
+	travelWays.mutex.Unlock()
+	for _, peer := range peers {
+		peer.refuse(reason)
+	}
+	for _, connection := range connections {
+		connection.Close()
+	}
+}
+
+func (travelWays *networkedTravelWays) isClosed() bool {
+	travelWays.mutex.Lock()
+	defer travelWays.mutex.Unlock()
+	return travelWays.closed
+}
+
+// Close takes every city off the network, see City.Close
+func (simulation *Simulation) Close(ctx context.Context) error {
+	var firstErr error
+	for _, city := range simulation.cities {
+		if err := city.Close(ctx); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("city %s: %w", city.name, err)
+		}
+	}
+	return firstErr
+}
+
+// blocks until every merchant sent over the network has been acknowledged, or ctx ends
+func (travelWays *networkedTravelWays) waitForHandoffs(ctx context.Context) error {
+	ticker := time.NewTicker(handoffPoll)
+	defer ticker.Stop()
+	for {
+		if travelWays.handedOff() {
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// whether nobody is waiting on a networked travel way or for an acknowledgement from a connected city.
+// Cities that hung up can't answer until they reconnect, so there is no point waiting for them
+func (travelWays *networkedTravelWays) handedOff() bool {
+	travelWays.mutex.Lock()
+	defer travelWays.mutex.Unlock()
+
+	for to := range travelWays.connected {
+		if len(travelWays.pending[to]) > 0 {
+			return false
+		}
+	}
+	for _, count := range travelWays.onTheWay {
+		if count > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// how many merchants we sent are still waiting to hear whether they were let in
+func (travelWays *networkedTravelWays) unanswered() int {
+	travelWays.mutex.Lock()
+	defer travelWays.mutex.Unlock()
+	count := 0
+	for _, pending := range travelWays.pending {
+		count += len(pending)
+	}
+	return count
+}
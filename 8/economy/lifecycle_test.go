@@ -0,0 +1,104 @@
+package economy
+
+import (
+	"context"
+	"image/color"
+	"testing"
+	"time"
+)
+
+func newListeningCity(t *testing.T, name string, seed int64) *City {
+	t.Helper()
+	city := NewCity(name, color.White, 0, seed)
+	if err := city.Listen(0); err != nil {
+		t.Fatal(err)
+	}
+	return city
+}
+
+// polls until the condition holds, failing the test if it takes too long
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("gave up waiting for %s", what)
+		}
+		time.Sleep(handoffPoll)
+	}
+}
+
+func TestCloseHangsUpOnPeers(t *testing.T) {
+	first := newListeningCity(t, "First", 1)
+	second := newListeningCity(t, "Second", 2)
+	defer second.Close(context.Background())
+
+	if err := second.CreateTravelWayToCity(first.NetworkAddress()); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the cities to connect", func() bool {
+		_, ok := second.outboundTravelWays.Load("First")
+		return ok
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := first.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := first.outboundTravelWays.Load("Second"); ok {
+		t.Error("First still has a travel way to Second after closing")
+	}
+	waitFor(t, "Second to notice First left", func() bool {
+		_, ok := second.outboundTravelWays.Load("First")
+		return !ok
+	})
+}
+
+func TestCloseHandsOverMerchantsThenHangsUp(t *testing.T) {
+	first := newListeningCity(t, "First", 1)
+	second := newListeningCity(t, "Second", 2)
+	defer second.Close(context.Background())
+
+	if err := second.CreateTravelWayToCity(first.NetworkAddress()); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the cities to connect", func() bool {
+		_, ok := first.outboundTravelWays.Load("Second")
+		return ok
+	})
+
+	channel, _ := first.outboundTravelWays.Load("Second")
+	merchant := NewMerchant(first, first.catalog.merchantGood())
+	first.merchants = append(first.merchants, merchant)
+	merchant.leaveCity(first, "Second", channel)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := first.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if returned := first.networkPorts.takeReturned(); len(returned) != 0 {
+		t.Errorf("%d merchants came back, the connection was fine", len(returned))
+	}
+
+	// Second hasn't taken the merchant off the travel way, so it keeps them once the connection is gone
+	arrived := 0
+	waitFor(t, "the merchant to reach Second", func() bool {
+		arrived += len(second.networkPorts.takeStranded())
+		return arrived > 0
+	})
+	time.Sleep(10 * handoffPoll)
+	if arrived += len(second.networkPorts.takeStranded()); arrived != 1 {
+		t.Errorf("%d merchants reached Second, expected the one sent before closing", arrived)
+	}
+}
+
+func TestCloseIsSafeToRepeat(t *testing.T) {
+	city := newListeningCity(t, "First", 1)
+	for i := 0; i < 2; i++ {
+		if err := city.Close(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -7,98 +7,130 @@ import (
 
 // Local tracks each market to buy and sell what they need
 type Local struct {
+	ID      AgentID
 	money   float64
+	debt    float64 // owed to the city's bank
+	savings float64 // deposited in the city's bank
+	credit  float64 // what the bank would still lend
 	markets map[Good]*Market
+
+	expectedWage float64 // what we think we would have to pay someone to work for us
+	employer     AgentID // who we last worked for, empty if we never have
+
+	born   int     // the tick we were born, 0 for the first locals
+	parent AgentID // empty for the first locals
+
+	transitTicks int // ticks left until we reach the city we are moving to
 }
 
-// NewLocal creates a new local
-func NewLocal() *Local {
+// NewLocal creates a new local valuing the goods of the catalog, drawing their preferences from rng
+func NewLocal(id AgentID, catalog *Catalog, rng *rand.Rand) *Local {
 	local := &Local{
-		money: 1000,
-		markets: map[Good]*Market{
-			WOOD:    NewMarket(rand.Intn(20), 4+rand.Float64()*4, 15),
-			CHAIR:   NewMarket(rand.Intn(10), 30+rand.Float64()*20, 5),
-			FUR:     NewMarket(rand.Intn(30), 1+rand.Float64()*2, 50),
-			BED:     NewMarket(rand.Intn(2), 50+rand.Float64()*10, 2),
-			LEISURE: NewMarket(0, 2+rand.Float64()*4, 50),
-		},
+		ID:      id,
+		money:   1000,
+		markets: make(map[Good]*Market),
+	}
+
+	for _, good := range append(catalog.Goods(), LEISURE) {
+		definition := catalog.definitions[good]
+		owned := 0
+		if definition.InitialOwned > 0 {
+			owned = rng.Intn(definition.InitialOwned)
+		}
+		baseValue := definition.BasePersonalValue + rng.Float64()*definition.BasePersonalValueSpread
+		local.markets[good] = NewMarket(rng, owned, baseValue, definition.HalfPersonalValueAt, definition.Volatility)
 	}
 
 	// set expected prices to match our current value
 	for good, market := range local.markets {
 		market.expectedMarketPrice = local.currentPersonalValue(good)
 	}
+	// and expect others to want what we would want for our time
+	local.expectedWage = local.valueToPrice(local.potentialPersonalValue(LEISURE))
 
 	return local
 }
 
 func (local *Local) update(city *City) {
 	// usually people don't try to buy or sell things
-	if rand.Float64() > 0.1 {
+	if city.rng.Float64() > 0.1 {
 		return
 	}
 
-	// we sometimes break a chair
-	if rand.Float64() < 0.01 {
-		if local.markets[CHAIR].ownedGoods > 0 {
-			local.markets[CHAIR].ownedGoods--
+	// we sometimes break things
+	for _, good := range city.catalog.goods {
+		if breakChance := city.catalog.definitions[good].BreakChance; breakChance > 0 && city.rng.Float64() < breakChance {
+			if local.markets[good].ownedGoods > 0 {
+				local.markets[good].ownedGoods--
+			}
 		}
 	}
 
-	// we sometimes break a bed
-	if rand.Float64() < 0.01 {
-		if local.markets[BED].ownedGoods > 0 {
-			local.markets[BED].ownedGoods--
+	// evaluate all your actions, doing nothing wins ties
+	bestRecipe := -1
+	bestValue := local.potentialPersonalValue(LEISURE)
+	for i, recipe := range city.catalog.recipes {
+		if value, possible := local.recipeValue(recipe, city); possible && value > bestValue {
+			bestRecipe = i
+			bestValue = value
 		}
 	}
 
-	// evaluate all your actions
-
-	doNothingValue := local.potentialPersonalValue(LEISURE)
-
-	cutWoodValue := math.Max(local.potentialPersonalValue(WOOD), local.priceToValue(local.markets[WOOD].expectedMarketPrice))
-
-	buildChairValue := 0.0
-	materialCount := 4
-	if local.markets[WOOD].ownedGoods > materialCount {
-		potentialChairValue := math.Max(local.potentialPersonalValue(CHAIR), local.priceToValue(local.markets[CHAIR].expectedMarketPrice))
-		materialValue := math.Max(local.currentPersonalValue(WOOD), local.priceToValue(local.markets[WOOD].expectedMarketPrice)) * float64(materialCount)
-		buildChairValue = potentialChairValue - materialValue
-	}
-
-	buildBedValue := 0.0
-	materialWoodCount := 2
-	materialFurCount := 3
-	if local.markets[WOOD].ownedGoods > materialWoodCount && local.markets[FUR].ownedGoods > materialFurCount {
-		potentialBedValue := math.Max(local.potentialPersonalValue(BED), local.priceToValue(local.markets[BED].expectedMarketPrice))
-		materialValue := math.Max(local.currentPersonalValue(WOOD), local.priceToValue(local.markets[WOOD].expectedMarketPrice))*float64(materialWoodCount) +
-			math.Max(local.currentPersonalValue(FUR), local.priceToValue(local.markets[FUR].expectedMarketPrice))*float64(materialFurCount)
-		buildBedValue = potentialBedValue - materialValue
+	// working for someone else is another option, they pay us and keep what we make
+	var job *jobOffer
+	if city.labor != nil {
+		if job = city.labor.bestOffer(city, local); job != nil && local.priceToValue(job.wage) <= bestValue {
+			job = nil
+		}
 	}
 
 	// act out the best action
-	maxValueAction := math.Max(math.Max(math.Max(doNothingValue, cutWoodValue), buildChairValue), buildBedValue)
-	if maxValueAction == doNothingValue {
+	if job != nil {
+		city.labor.hire(city, job, local)
+		local.markets[LEISURE].ownedGoods = 0
+	} else if bestRecipe < 0 {
 		local.markets[LEISURE].ownedGoods++ // we value doing nothing less and less the more we do it (diminishing utility)
+		city.leisureTaken++
 	} else {
-		if maxValueAction == cutWoodValue {
-			local.markets[WOOD].ownedGoods++
-		} else if maxValueAction == buildChairValue {
-			local.markets[WOOD].ownedGoods -= materialCount
-			local.markets[CHAIR].ownedGoods++
-		} else if maxValueAction == buildBedValue {
-			local.markets[WOOD].ownedGoods -= materialWoodCount
-			local.markets[FUR].ownedGoods -= materialFurCount
-			local.markets[BED].ownedGoods++
+		for _, input := range city.catalog.recipes[bestRecipe].Inputs {
+			local.markets[input.Good].ownedGoods -= input.Count
+		}
+		for _, output := range city.catalog.recipes[bestRecipe].Outputs {
+			local.markets[output.Good].ownedGoods += city.harvest(output.Good, output.Count*city.productivity(output.Good))
 		}
 		local.markets[LEISURE].ownedGoods = 0 // make sure we have renewed value for doing nothing since we just did something
 	}
 
-	for good := range local.markets {
-		if good != LEISURE {
-			local.updateMarket(good, city.allEconomicAgents())
+	// and we might want someone to work for us
+	if city.labor != nil {
+		city.labor.post(city, local)
+	}
+
+	nearbyAgents := city.allEconomicAgents()
+	for _, good := range city.catalog.goods {
+		local.updateMarket(good, city, nearbyAgents)
+	}
+}
+
+// how much a recipe is worth to us: what we could get for the outputs minus what we could get for the inputs.
+// Returns false if we don't have the materials
+func (local *Local) recipeValue(recipe Recipe, city *City) (float64, bool) {
+	value := 0.0
+	for _, input := range recipe.Inputs {
+		if local.markets[input.Good].ownedGoods <= input.Count {
+			return 0, false
 		}
+		value -= local.goodValue(input.Good, local.currentPersonalValue(input.Good)) * float64(input.Count)
 	}
+	for _, output := range recipe.Outputs {
+		value += local.goodValue(output.Good, local.potentialPersonalValue(output.Good)) * city.expectedYield(output.Good, output.Count)
+	}
+	return value, true
+}
+
+// a good is worth whichever is more, keeping it or selling it
+func (local *Local) goodValue(good Good, personalValue float64) float64 {
+	return math.Max(personalValue, local.priceToValue(local.markets[good].expectedMarketPrice))
 }
 
 func (local *Local) isSelling(good Good) (bool, float64) {
@@ -108,19 +140,133 @@ func (local *Local) isSelling(good Good) (bool, float64) {
 	return true, local.markets[good].expectedMarketPrice
 }
 
+func (local *Local) isBuying(_ *City, good Good) (bool, float64) {
+	if !local.isBuyer(good) {
+		return false, 0
+	}
+	return true, local.markets[good].expectedMarketPrice
+}
+
 func (local *Local) transact(good Good, buying bool, price float64) {
 	local.markets[good].timeSinceLastTransaction = 0
 	if buying {
 		local.money -= price
 		local.markets[good].ownedGoods++
-		local.markets[good].expectedMarketPrice -= local.markets[good].beliefVolatility
 	} else {
 		local.money += price
 		local.markets[good].ownedGoods--
-		local.markets[good].expectedMarketPrice += local.markets[good].beliefVolatility
 	}
+	local.markets[good].believe(func(expected, volatility float64) float64 {
+		return local.markets[good].beliefs.Traded(expected, volatility, buying, price)
+	})
+}
+
+func (local *Local) gossip(good Good) (float64, bool) {
+	market, ok := local.markets[good]
+	if !ok {
+		return 0, false
+	}
+	return market.expectedMarketPrice, true
+}
+
+func (local *Local) id() AgentID {
+	return local.ID
+}
+
+func (local *Local) kind() AgentKind {
+	return LocalAgent
+}
+
+func (local *Local) balance() float64 {
+	return local.money
+}
+
+func (local *Local) addMoney(amount float64) {
+	local.money += amount
+}
+
+func (local *Local) setDebt(_ cityName, debt float64) {
+	local.debt = debt
+}
+
+// Debt returns how much the local owes the bank
+func (local *Local) Debt() float64 {
+	return local.debt
+}
+
+// Savings returns how much the local has deposited in the bank
+func (local *Local) Savings() float64 {
+	return local.savings
+}
+
+func (local *Local) strategy() string {
+	return string(LocalAgent) + "/" + local.BeliefRule()
+}
+
+func (local *Local) holding(good Good) int {
+	if market, ok := local.markets[good]; ok {
+		return market.ownedGoods
+	}
+	return 0
+}
+
+// SetBeliefRule changes how the local updates their expected prices, every good gets a new rule
+func (local *Local) SetBeliefRule(name string) error {
+	for _, market := range local.markets {
+		rule, err := NewBeliefRule(name)
+		if err != nil {
+			return err
+		}
+		market.beliefs = rule
+	}
+	return nil
+}
+
+// BeliefRule returns the name of the rule the local updates their expected prices with
+func (local *Local) BeliefRule() string {
+	return local.markets[LEISURE].beliefs.Name()
+}
+
+// ExpectedWage returns what the local thinks they would have to pay someone to work for them
+func (local *Local) ExpectedWage() float64 {
+	return local.expectedWage
+}
+
+// Employer returns who the local last worked for, empty if they never have
+func (local *Local) Employer() AgentID {
+	return local.employer
+}
+
+// Born returns the tick the local was born, 0 if they were one of the first locals
+func (local *Local) Born() int {
+	return local.born
+}
+
+// Money returns how much money the local has
+func (local *Local) Money() float64 {
+	return local.money
+}
+
+// Owned returns how many of a good the local owns
+func (local *Local) Owned(good Good) int {
+	return local.markets[good].ownedGoods
+}
+
+// BasePersonalValue returns how much the local values their first unit of a good
+func (local *Local) BasePersonalValue(good Good) float64 {
+	return local.markets[good].basePersonalValue
+}
+
+// Utility returns how much the local enjoys everything they own of a good, the sum of the value of each unit
+func (local *Local) Utility(good Good) float64 {
+	utility := 0.0
+	for x := 1; x <= local.markets[good].ownedGoods; x++ {
+		utility += local.personalValue(good, x)
+	}
+	return utility
 }
 
-func (local *Local) gossip(good Good) float64 {
+// ExpectedPrice returns what the local believes a good sells for
+func (local *Local) ExpectedPrice(good Good) float64 {
 	return local.markets[good].expectedMarketPrice
 }
@@ -8,7 +8,7 @@ import (
 // Good is a string that is used to represent different goods
 type Good string
 
-// WOOD is a good
+// the goods of the default economy, scenarios can define their own
 const (
 	WOOD    Good = "wood"
 	CHAIR   Good = "chair"
@@ -17,8 +17,6 @@ const (
 	LEISURE Good = "leisure"
 )
 
-var goods = []Good{WOOD, CHAIR, FUR, BED}
-
 // Market is what an agent uses to track the economy
 type Market struct {
 	ownedGoods int
@@ -32,81 +30,74 @@ type Market struct {
 	maxTimeSinceLastTransaction int
 
 	expectedMarketPrice float64
+	beliefs             BeliefRule // how the expected price changes
 }
 
-// NewMarket creates a new market
-func NewMarket(owned int, baseValue, halfValueAt float64) *Market {
+// NewMarket creates a new market, the initial expected price is drawn from rng.
+// volatility is how far beliefs move on each trade, as a fraction of baseValue
+func NewMarket(rng *rand.Rand, owned int, baseValue, halfValueAt, volatility float64) *Market {
 	market := &Market{
 		ownedGoods:                  owned,
 		basePersonalValue:           baseValue,
 		halfPersonalValueAt:         halfValueAt,
-		beliefVolatility:            baseValue / 50,
+		beliefVolatility:            baseValue * volatility,
 		timeSinceLastTransaction:    0,
 		maxTimeSinceLastTransaction: 10,
 		gossipFrequency:             0.01,
-		expectedMarketPrice:         (rand.Float64() - 0.5) + baseValue,
+		expectedMarketPrice:         (rng.Float64() - 0.5) + baseValue,
+		beliefs:                     &NudgeBeliefs{},
 	}
 
 	return market
 }
 
-func (local *Local) updateMarket(good Good, nearbyAgents map[EconomicAgent]bool) {
+func (local *Local) updateMarket(good Good, city *City, nearbyAgents []EconomicAgent) {
+	rng := city.rng
 
 	// gossip, hear about other economies as well
-	if rand.Float64() < local.markets[good].gossipFrequency {
-		for otherAgent := range nearbyAgents {
-			otherExpectedPrice := otherAgent.gossip(good)
-			if otherExpectedPrice > local.markets[good].expectedMarketPrice {
-				local.markets[good].expectedMarketPrice += local.markets[good].beliefVolatility
-			} else if otherExpectedPrice < local.markets[good].expectedMarketPrice {
-				local.markets[good].expectedMarketPrice -= local.markets[good].beliefVolatility
-			}
-			break
+	if rng.Float64() < local.markets[good].gossipFrequency && len(nearbyAgents) > 0 {
+		otherAgent := nearbyAgents[rng.Intn(len(nearbyAgents))]
+		if heard, ok := otherAgent.gossip(good); ok {
+			local.markets[good].believe(func(expected, volatility float64) float64 {
+				return local.markets[good].beliefs.Heard(expected, volatility, heard)
+			})
 		}
 	}
 	willingBuyPrice := local.markets[good].expectedMarketPrice
+	spendingPower := city.spendingPower(local) // money, savings and credit
 
 	// only track failed time for when we could transact but didn't
-	if local.isBuyer(good) && local.money >= willingBuyPrice {
+	if local.isBuyer(good) && spendingPower >= willingBuyPrice {
 		local.markets[good].timeSinceLastTransaction++
 	} else if local.isSeller(good) && local.markets[good].ownedGoods > 0 {
 		local.markets[good].timeSinceLastTransaction++
 	}
 
+	// let everyone know if we are selling
+	city.market.offer(city, good, local)
+
 	// only buyers initiate transactions (usually buyers come to sellers, not the other way around)
-	if local.isBuyer(good) && local.money >= willingBuyPrice {
-
-		// look for a seller, simulates going from shop to shop
-		for otherAgent := range nearbyAgents { // randomly iterates through everyone
-
-			isSeller, sellingPrice := otherAgent.isSelling(good)
-			if !isSeller {
-				continue
-			}
-			if willingBuyPrice < sellingPrice || local.money < sellingPrice { // the buyer is unwilling or unable to buy at this price
-				continue
-			}
-
-			// made it past all the checks, this is someone we can buy from
-			local.transact(good, true, sellingPrice)
-			otherAgent.transact(good, false, sellingPrice)
-			break
-		}
+	if local.isBuyer(good) && spendingPower >= willingBuyPrice {
+		// unwilling or unable to pay more than this
+		city.market.buy(city, good, local, math.Min(willingBuyPrice, spendingPower), nearbyAgents)
 	}
 
 	// if we haven't transacted in a while then update expected values
 	if local.markets[good].timeSinceLastTransaction > local.markets[good].maxTimeSinceLastTransaction {
 		local.markets[good].timeSinceLastTransaction = 0
-		if local.isBuyer(good) {
-			// need to be willing to pay more
-			local.markets[good].expectedMarketPrice += local.markets[good].beliefVolatility
-		} else if local.isSeller(good) {
-			// need to be willing to sell for lower
-			local.markets[good].expectedMarketPrice -= local.markets[good].beliefVolatility
+		if isBuyer, isSeller := local.isBuyer(good), local.isSeller(good); isBuyer || isSeller {
+			local.markets[good].believe(func(expected, volatility float64) float64 {
+				return local.markets[good].beliefs.Stale(expected, volatility, isBuyer)
+			})
 		}
 	}
 }
 
+// updates the expected price with one of the belief rule's methods
+func (market *Market) believe(update func(expected, volatility float64) float64) {
+	market.expectedMarketPrice = update(market.expectedMarketPrice, market.beliefVolatility)
+}
+
 // should not be called anywhere except from potentialValue and currentValue
 func (local Local) personalValue(good Good, x int) float64 {
 	S := local.markets[good].basePersonalValue
@@ -142,6 +133,8 @@ func (local *Local) valueToPrice(value float64) float64 {
 }
 
 func (local *Local) utilityPerDollar() float64 {
-	// utility per dollar has diminishing returns
-	return 1000.0 / (local.money + 1.0)
+	// utility per dollar has diminishing returns. What we could spend counts, so borrowing doesn't make us feel any richer:
+	// it moves money from credit (already net of what we owe) into money
+	wealth := math.Max(local.money+local.savings+local.credit, 0)
+	return 1000.0 / (wealth + 1.0)
 }
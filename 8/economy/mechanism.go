@@ -0,0 +1,292 @@
+package economy
+
+import (
+	"fmt"
+	"sort"
+)
+
+// MarketMechanism decides how buyers and sellers in a city find each other. Every trade still goes through city.trade
+type MarketMechanism interface {
+	// called every time an agent updates a good they might sell
+	offer(city *City, good Good, seller EconomicAgent)
+	// the buyer wants one unit for at most limit, candidates are who they would consider buying from.
+	// Returns whether they bought anything, mechanisms with an order book may match anyone in the book
+	buy(city *City, good Good, buyer EconomicAgent, limit float64, candidates []EconomicAgent) bool
+	Name() string
+}
+
+// the market mechanisms that can be chosen by name
+const (
+	SearchMarketName  = "search"
+	AuctionMarketName = "auction"
+)
+
+// NewMarketMechanism creates a market mechanism from its name
+func NewMarketMechanism(name string) (MarketMechanism, error) {
+	switch name {
+	case "", SearchMarketName:
+		return NewSearchMarket(), nil
+	case AuctionMarketName:
+		return NewAuctionMarket(), nil
+	}
+	return nil, fmt.Errorf("unknown market mechanism %q", name)
+}
+
+// SearchMarket has buyers walk from shop to shop in a random order, buying from the first seller cheap enough
+type SearchMarket struct{}
+
+// NewSearchMarket creates the decentralised search market
+func NewSearchMarket() *SearchMarket {
+	return &SearchMarket{}
+}
+
+// Name implements MarketMechanism
+func (market *SearchMarket) Name() string {
+	return SearchMarketName
+}
+
+func (market *SearchMarket) offer(city *City, good Good, seller EconomicAgent) {
+	// sellers just wait for buyers to come by
+}
+
+func (market *SearchMarket) buy(city *City, good Good, buyer EconomicAgent, limit float64, candidates []EconomicAgent) bool {
+	// look for a seller, simulates going from shop to shop
+	for _, i := range city.rng.Perm(len(candidates)) { // randomly iterates through everyone
+		seller := candidates[i]
+		if seller == buyer {
+			continue
+		}
+
+		isSeller, sellingPrice := seller.isSelling(good)
+		if !isSeller || sellingPrice > limit { // the buyer is unwilling or unable to buy at this price
+			continue
+		}
+
+		// made it past all the checks, this is someone we can buy from
+		city.trade(good, buyer, seller, sellingPrice)
+		return true
+	}
+	return false
+}
+
+// how many rounds (updates of everyone in the city) an order stays in the book if it isn't refreshed
+const orderLifetime = 10
+
+type order struct {
+	agent    EconomicAgent
+	price    float64
+	sequence int // earlier orders win ties
+	placed   int // the round the order was placed
+}
+
+type orderBook struct {
+	bids []*order // best (highest) first
+	asks []*order // best (lowest) first
+}
+
+// AuctionMarket is a continuous double auction. Buyers post bids and sellers post asks into a book for each good,
+// whenever they cross the trade happens at the price of the order that was waiting (price-time priority)
+type AuctionMarket struct {
+	books    map[Good]*orderBook
+	sequence int
+}
+
+// NewAuctionMarket creates an empty double auction
+func NewAuctionMarket() *AuctionMarket {
+	return &AuctionMarket{
+		books: make(map[Good]*orderBook),
+	}
+}
+
+// Name implements MarketMechanism
+func (market *AuctionMarket) Name() string {
+	return AuctionMarketName
+}
+
+func (market *AuctionMarket) book(good Good) *orderBook {
+	if _, ok := market.books[good]; !ok {
+		market.books[good] = &orderBook{}
+	}
+	return market.books[good]
+}
+
+// Bids returns the prices of the waiting bids for a good, best first
+func (market *AuctionMarket) Bids(good Good) []float64 {
+	return orderPrices(market.book(good).bids)
+}
+
+// Asks returns the prices of the waiting asks for a good, best first
+func (market *AuctionMarket) Asks(good Good) []float64 {
+	return orderPrices(market.book(good).asks)
+}
+
+func orderPrices(orders []*order) []float64 {
+	prices := make([]float64, len(orders))
+	for i, order := range orders {
+		prices[i] = order.price
+	}
+	return prices
+}
+
+func (market *AuctionMarket) offer(city *City, good Good, seller EconomicAgent) {
+	book := market.book(good)
+	isSeller, askPrice := seller.isSelling(good)
+
+	previous := removeOrder(&book.asks, seller)
+	if !isSeller {
+		return
+	}
+
+	// the ask crosses a waiting bid, sell at the bid's price
+	for len(book.bids) > 0 {
+		bid := book.bids[0]
+		if !market.bidValid(city, good, bid) {
+			book.bids = book.bids[1:]
+			continue
+		}
+		if bid.price < askPrice || bid.agent == seller {
+			break
+		}
+		book.bids = book.bids[1:]
+		city.trade(good, bid.agent, seller, bid.price)
+		return
+	}
+
+	// keep our place in line if nothing changed
+	ask := &order{agent: seller, price: askPrice, placed: city.round}
+	if previous != nil && previous.price == askPrice {
+		ask.sequence = previous.sequence
+	} else {
+		market.sequence++
+		ask.sequence = market.sequence
+	}
+	insertOrder(&book.asks, ask, func(a, b *order) bool {
+		return a.price < b.price || (a.price == b.price && a.sequence < b.sequence)
+	})
+}
+
+func (market *AuctionMarket) buy(city *City, good Good, buyer EconomicAgent, limit float64, candidates []EconomicAgent) bool {
+	book := market.book(good)
+	previous := removeOrder(&book.bids, buyer)
+
+	// the bid crosses a waiting ask, buy at the ask's price
+	for len(book.asks) > 0 {
+		ask := book.asks[0]
+		if !market.askValid(city, good, ask) {
+			book.asks = book.asks[1:]
+			continue
+		}
+		if ask.price > limit || ask.agent == buyer {
+			break
+		}
+		book.asks = book.asks[1:]
+		city.trade(good, buyer, ask.agent, ask.price)
+		return true
+	}
+
+	bid := &order{agent: buyer, price: limit, placed: city.round}
+	if previous != nil && previous.price == limit {
+		bid.sequence = previous.sequence
+	} else {
+		market.sequence++
+		bid.sequence = market.sequence
+	}
+	insertOrder(&book.bids, bid, func(a, b *order) bool {
+		return a.price > b.price || (a.price == b.price && a.sequence < b.sequence)
+	})
+	return false
+}
+
+// an ask is only good if the seller is still here and still selling at that price
+func (market *AuctionMarket) askValid(city *City, good Good, ask *order) bool {
+	if city.round-ask.placed > orderLifetime || !city.isPresent(ask.agent) {
+		return false
+	}
+	isSeller, price := ask.agent.isSelling(good)
+	return isSeller && price == ask.price
+}
+
+// a bid is only good if the buyer is still here, still wants the good at that price and can still afford it
+func (market *AuctionMarket) bidValid(city *City, good Good, bid *order) bool {
+	if city.round-bid.placed > orderLifetime || !city.isPresent(bid.agent) {
+		return false
+	}
+	isBuyer, price := bid.agent.isBuying(city, good)
+	return isBuyer && price >= bid.price && city.spendingPower(bid.agent) >= bid.price
+}
+
+// removes the agent's order if they have one, returning it
+func removeOrder(orders *[]*order, agent EconomicAgent) *order {
+	for i, order := range *orders {
+		if order.agent == agent {
+			*orders = append((*orders)[:i], (*orders)[i+1:]...)
+			return order
+		}
+	}
+	return nil
+}
+
+func insertOrder(orders *[]*order, newOrder *order, before func(a, b *order) bool) {
+	i := sort.Search(len(*orders), func(i int) bool { return before(newOrder, (*orders)[i]) })
+	*orders = append(*orders, nil)
+	copy((*orders)[i+1:], (*orders)[i:])
+	(*orders)[i] = newOrder
+}
+
+type orderState struct {
+	Agent    AgentID `json:"agent"`
+	Price    float64 `json:"price"`
+	Sequence int     `json:"sequence"`
+	Placed   int     `json:"placed"`
+}
+
+type orderBookState struct {
+	Bids []orderState `json:"bids"`
+	Asks []orderState `json:"asks"`
+}
+
+// what is needed to save and restore the waiting orders, agents are saved by id
+type auctionState struct {
+	Sequence int                     `json:"sequence"`
+	Books    map[Good]orderBookState `json:"books"`
+}
+
+func (market *AuctionMarket) save() *auctionState {
+	state := &auctionState{
+		Sequence: market.sequence,
+		Books:    make(map[Good]orderBookState),
+	}
+	for good, book := range market.books {
+		state.Books[good] = orderBookState{Bids: saveOrders(book.bids), Asks: saveOrders(book.asks)}
+	}
+	return state
+}
+
+func saveOrders(orders []*order) []orderState {
+	saved := make([]orderState, len(orders))
+	for i, order := range orders {
+		saved[i] = orderState{Agent: order.agent.id(), Price: order.price, Sequence: order.sequence, Placed: order.placed}
+	}
+	return saved
+}
+
+// orders from agents who are no longer in the city are dropped, they could never be matched anyway
+func (market *AuctionMarket) restore(state *auctionState, agents map[AgentID]EconomicAgent) {
+	market.sequence = state.Sequence
+	for good, book := range state.Books {
+		market.books[good] = &orderBook{
+			bids: restoreOrders(book.Bids, agents),
+			asks: restoreOrders(book.Asks, agents),
+		}
+	}
+}
+
+func restoreOrders(saved []orderState, agents map[AgentID]EconomicAgent) []*order {
+	orders := make([]*order, 0, len(saved))
+	for _, state := range saved {
+		if agent, ok := agents[state.Agent]; ok {
+			orders = append(orders, &order{agent: agent, price: state.Price, sequence: state.Sequence, placed: state.Placed})
+		}
+	}
+	return orders
+}
@@ -0,0 +1,145 @@
+package economy
+
+import (
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+func newAuctionCity() (*City, *AuctionMarket, Good) {
+	city := NewCity("A", color.White, 0, 1)
+	market := NewAuctionMarket()
+	city.SetMarketMechanism(market)
+	return city, market, city.catalog.merchantGood()
+}
+
+// a merchant in the city with one unit to sell there for price
+func newTestSeller(city *City, good Good, price float64) *Merchant {
+	merchant := NewMerchant(city, good)
+	merchant.Owned = 1
+	merchant.ExpectedPrices[good][city.name] = price
+	merchant.bestSellLocation = city.name
+	return merchant
+}
+
+// a merchant in the city who would pay up to price, to sell somewhere else for more
+func newTestBuyer(city *City, good Good, price float64) *Merchant {
+	merchant := NewMerchant(city, good)
+	merchant.ExpectedPrices[good][city.name] = price
+	merchant.ExpectedPrices[good]["elsewhere"] = 2 * price
+	merchant.bestSellLocation = "elsewhere"
+	return merchant
+}
+
+func TestAuctionBuysAtWaitingAsk(t *testing.T) {
+	city, market, good := newAuctionCity()
+	seller := newTestSeller(city, good, 10)
+	buyer := newTestBuyer(city, good, 12)
+
+	market.offer(city, good, seller)
+	if asks := market.Asks(good); !reflect.DeepEqual(asks, []float64{10}) {
+		t.Fatalf("asks are %v, expected the seller's ask to wait", asks)
+	}
+	if !market.buy(city, good, buyer, 12, nil) {
+		t.Fatal("the bid crossed the ask but nothing was bought")
+	}
+	if buyer.Owned != 1 || seller.Owned != 0 {
+		t.Errorf("buyer has %d and seller has %d, the unit should have changed hands", buyer.Owned, seller.Owned)
+	}
+	if buyer.Money != 990 || seller.Money != 1010 {
+		t.Errorf("buyer has %v and seller has %v, expected the trade at the waiting ask of 10", buyer.Money, seller.Money)
+	}
+	if len(market.Asks(good)) != 0 || len(market.Bids(good)) != 0 {
+		t.Errorf("the book should be empty, has bids %v and asks %v", market.Bids(good), market.Asks(good))
+	}
+}
+
+func TestAuctionSellsAtWaitingBid(t *testing.T) {
+	city, market, good := newAuctionCity()
+	seller := newTestSeller(city, good, 10)
+	buyer := newTestBuyer(city, good, 12)
+
+	if market.buy(city, good, buyer, 12, nil) {
+		t.Fatal("bought from an empty book")
+	}
+	market.offer(city, good, seller)
+	if buyer.Money != 988 || seller.Money != 1012 {
+		t.Errorf("buyer has %v and seller has %v, expected the trade at the waiting bid of 12", buyer.Money, seller.Money)
+	}
+}
+
+func TestAuctionOrdersWaitUntilTheyCross(t *testing.T) {
+	city, market, good := newAuctionCity()
+	market.offer(city, good, newTestSeller(city, good, 15))
+	market.buy(city, good, newTestBuyer(city, good, 12), 12, nil)
+	market.buy(city, good, newTestBuyer(city, good, 13), 13, nil)
+
+	if bids := market.Bids(good); !reflect.DeepEqual(bids, []float64{13, 12}) {
+		t.Errorf("bids are %v, expected the best first", bids)
+	}
+	if asks := market.Asks(good); !reflect.DeepEqual(asks, []float64{15}) {
+		t.Errorf("asks are %v", asks)
+	}
+}
+
+func TestAuctionPriceTimePriority(t *testing.T) {
+	city, market, good := newAuctionCity()
+	first := newTestSeller(city, good, 10)
+	second := newTestSeller(city, good, 10)
+	cheapest := newTestSeller(city, good, 9)
+	market.offer(city, good, first)
+	market.offer(city, good, second)
+	market.offer(city, good, cheapest)
+
+	market.buy(city, good, newTestBuyer(city, good, 10), 10, nil)
+	if cheapest.Owned != 0 {
+		t.Error("the cheapest ask should sell first")
+	}
+	market.buy(city, good, newTestBuyer(city, good, 10), 10, nil)
+	if first.Owned != 0 || second.Owned != 1 {
+		t.Error("of two asks at the same price the earlier one should sell first")
+	}
+
+	// asking the same price again keeps the seller's place in line
+	third := newTestSeller(city, good, 10)
+	market.offer(city, good, third)
+	market.offer(city, good, second)
+	market.buy(city, good, newTestBuyer(city, good, 10), 10, nil)
+	if second.Owned != 0 || third.Owned != 1 {
+		t.Error("refreshing an ask at the same price should keep its place")
+	}
+}
+
+func TestAuctionDropsBidsTheBuyerNoLongerWants(t *testing.T) {
+	city, market, good := newAuctionCity()
+	buyer := newTestBuyer(city, good, 12)
+	market.buy(city, good, buyer, 12, nil)
+
+	buyer.ExpectedPrices[good][city.name] = 8 // changed their mind since bidding
+	seller := newTestSeller(city, good, 10)
+	market.offer(city, good, seller)
+	if buyer.Owned != 0 || seller.Owned != 1 {
+		t.Fatal("traded with a bid the buyer no longer stands behind")
+	}
+	if len(market.Bids(good)) != 0 {
+		t.Errorf("the stale bid should be gone, bids are %v", market.Bids(good))
+	}
+	if asks := market.Asks(good); !reflect.DeepEqual(asks, []float64{10}) {
+		t.Errorf("asks are %v, expected the seller's ask to wait", asks)
+	}
+}
+
+func TestAuctionDropsExpiredOrders(t *testing.T) {
+	city, market, good := newAuctionCity()
+	seller := newTestSeller(city, good, 10)
+	market.offer(city, good, seller)
+
+	city.round += orderLifetime + 1
+	buyer := newTestBuyer(city, good, 12)
+	if market.buy(city, good, buyer, 12, nil) {
+		t.Error("bought from an ask that should have expired")
+	}
+	if bids := market.Bids(good); !reflect.DeepEqual(bids, []float64{12}) {
+		t.Errorf("bids are %v, expected the buyer's bid to wait", bids)
+	}
+}
@@ -2,25 +2,34 @@ package economy
 
 import (
 	"fmt"
-	"math/rand"
+	"math"
 )
 
 // Merchant tracks lots of information about each city in order to optimally arbitrage
 // As annoying as it is, the JSON package needs access to the fields of Merchant, which it can only do if they are public
 type Merchant struct {
+	ID               AgentID
 	Money            float64
 	city             cityName
 	BuysSells        Good
 	CarryingCapacity int
 	Owned            int
-	ExpectedPrices   map[Good]map[cityName]float64 // merchants use this instead of the value in the market
+	ExpectedPrices   map[Good]map[cityName]float64     // merchants use this instead of the value in the market
+	Debts            map[cityName]float64              `json:",omitempty"` // owed to the banks of other cities
+	TransitTicks     int                               `json:",omitempty"` // ticks left until the merchant reaches the city they are travelling to
+	Routes           map[cityName]map[cityName]float64 `json:",omitempty"` // travel ways seen so far and what carrying a unit along them costs
+	Plan             []cityName                        `json:",omitempty"` // cities still to pass through, ending where the merchant wants to sell
 
 	bestSellLocation cityName // helpful to track
 }
 
+// what merchants assume travelling costs if nobody told them otherwise
+const defaultTravelCost = 1.0
+
 // NewMerchant creates a merchant
 func NewMerchant(city *City, good Good) *Merchant {
 	merchant := &Merchant{
+		ID:               city.newID(MerchantAgent),
 		Money:            1000,
 		city:             city.name,
 		BuysSells:        good,
@@ -30,7 +39,7 @@ func NewMerchant(city *City, good Good) *Merchant {
 	}
 
 	// initialize expected prices
-	for _, good := range goods {
+	for _, good := range city.catalog.goods {
 		merchant.ExpectedPrices[good] = make(map[cityName]float64)
 		// only know starting cities values, as we find more cities we can update
 		merchant.ExpectedPrices[good][city.name] = 0
@@ -42,66 +51,65 @@ func NewMerchant(city *City, good Good) *Merchant {
 func (merchant *Merchant) update(city *City) {
 
 	// usually people don't try to buy or sell things
-	if rand.Float64() > 0.1 {
+	if city.rng.Float64() > 0.1 {
 		return
 	}
 
 	// get some gossip
-	for local := range city.allEconomicAgents() {
-		for good := range merchant.ExpectedPrices { // make sure its random
-			merchant.ExpectedPrices[good][city.name] = 0.9*merchant.ExpectedPrices[good][city.name] + 0.1*local.gossip(good)
+	for _, agent := range city.allEconomicAgents() {
+		for _, good := range city.catalog.goods {
+			if heard, ok := agent.gossip(good); ok {
+				merchant.ExpectedPrices[good][city.name] = 0.9*merchant.ExpectedPrices[good][city.name] + 0.1*heard
+			}
 		}
 	}
 
+	merchant.learnRoutes(city)
+
 	// look to buy
-	willingBuyPrice := merchant.ExpectedPrices[merchant.BuysSells][merchant.city]
-	merchant.bestSellLocation, _ = merchant.bestDeal(merchant.BuysSells, city)
-	bestSellPrice := merchant.ExpectedPrices[merchant.BuysSells][merchant.bestSellLocation]
-
-	if merchant.bestSellLocation != merchant.city && merchant.Owned < merchant.CarryingCapacity { // no possible profit by buying and selling in same location
-		// try and find someone to buy from
-		for otherAgent := range city.locals {
-			isSeller, sellingPrice := otherAgent.isSelling(merchant.BuysSells)
-			if !isSeller {
-				continue
-			}
+	tripCosts := merchant.allTripCosts()
+	bestBuyLocation, bestSellLocation, _ := merchant.bestDeal(merchant.BuysSells, city, tripCosts)
+	merchant.bestSellLocation = bestSellLocation
 
-			if willingBuyPrice < sellingPrice || merchant.Money < sellingPrice { // merchant is unwilling or unable to buy at this price
-				continue
-			}
+	// let everyone know if we are selling
+	city.market.offer(city, merchant.BuysSells, merchant)
 
-			if bestSellPrice-sellingPrice <= 0 { // merchant wouldn't make a profit buying this good here
-				continue
-			}
+	if isBuyer, willingBuyPrice := merchant.isBuying(city, merchant.BuysSells); isBuyer {
+		// try and find someone to buy from, the merchant is unwilling or unable to pay more than this
+		limit := math.Min(willingBuyPrice, city.spendingPower(merchant))
 
-			// made it past all the checks, this is someone we can buy from
-			merchant.transact(merchant.BuysSells, true, sellingPrice)
-			otherAgent.transact(merchant.BuysSells, false, sellingPrice)
-			break
+		sellers := make([]EconomicAgent, len(city.locals))
+		for i, local := range city.locals {
+			sellers[i] = local
 		}
+		city.market.buy(city, merchant.BuysSells, merchant, limit, sellers)
 	}
 
 	// randomly move cities
-	if rand.Intn(1000) == 0 {
-		city.outboundTravelWays.Range(func(_ cityName, outboundTravelWay chan *Merchant) bool {
-			merchant.leaveCity(city, outboundTravelWay)
-			return false
-		})
+	if city.rng.Intn(1000) == 0 {
+		if destination, outboundTravelWay, ok := city.outboundTravelWays.Random(city.rng); ok {
+			merchant.Plan = nil
+			merchant.leaveCity(city, destination, outboundTravelWay)
+		}
 		return
 	}
 
 	// change cities once we bought our good in bulk
 	if merchant.Owned >= merchant.CarryingCapacity && merchant.city != merchant.bestSellLocation {
-		// make sure we have a path there, if not, randomly move (smarter merchants could potentially do path finding, Q learning?)
-		if outboundTravelWay, ok := city.outboundTravelWays.Load(merchant.bestSellLocation); ok {
-			merchant.leaveCity(city, outboundTravelWay)
+		// take the next step of the cheapest route we know there, if we don't know one, randomly move
+		if nextCity, outboundTravelWay, ok := merchant.nextHop(city, merchant.bestSellLocation); ok {
+			merchant.leaveCity(city, nextCity, outboundTravelWay)
 			return
-		} else if len(city.outboundTravelWays.channels) > 0 {
-			// get random travelWay by using first in iteration
-			city.outboundTravelWays.Range(func(_ cityName, randomOutboundTravelWay chan *Merchant) bool {
-				merchant.leaveCity(city, randomOutboundTravelWay)
-				return false
-			})
+		} else if destination, randomOutboundTravelWay, ok := city.outboundTravelWays.Random(city.rng); ok {
+			merchant.leaveCity(city, destination, randomOutboundTravelWay)
+			return
+		}
+	}
+
+	// with nothing left to sell, head to wherever the good is cheapest to buy
+	if merchant.Owned == 0 && bestBuyLocation != merchant.city {
+		if nextCity, outboundTravelWay, ok := merchant.nextHop(city, bestBuyLocation); ok {
+			merchant.leaveCity(city, nextCity, outboundTravelWay)
 			return
 		}
 	}
@@ -110,7 +118,7 @@ func (merchant *Merchant) update(city *City) {
 	// if merchant.Owned == 0 {
 	// 	bestGood, bestProfit := BED, 0.0
 	// 	for good := range merchant.ExpectedPrices {
-	// 		_, potentialProfit := merchant.bestDeal(good, city)
+	// 		_, _, potentialProfit := merchant.bestDeal(good, city, tripCosts)
 	// 		if potentialProfit > bestProfit {
 	// 			bestProfit = potentialProfit
 	// 			bestGood = good
@@ -121,11 +129,19 @@ func (merchant *Merchant) update(city *City) {
 	// }
 }
 
-func (merchant *Merchant) leaveCity(city *City, outboundTravelWay chan *Merchant) {
+func (merchant *Merchant) leaveCity(city *City, destination cityName, outboundTravelWay chan *Merchant) {
 	// remove self from city
-	delete(city.merchants, merchant)
+	city.removeMerchant(merchant)
+	// pay for the journey, the longer it is the longer we are on the road
+	if fare := city.fare(destination); fare > 0 {
+		city.taxReport.Fares += city.collect(merchant, fare)
+	}
+	merchant.TransitTicks = city.transitTicks(destination)
 	// enter travelWay
 	merchant.city = "traveling..." // not necessary, gets ignored by JSON serializer
+	if city.networkPorts != nil {
+		city.networkPorts.settingOff(outboundTravelWay)
+	}
 	outboundTravelWay <- merchant
 }
 
@@ -141,6 +157,16 @@ func (merchant *Merchant) isSelling(good Good) (bool, float64) {
 	return false, 0
 }
 
+func (merchant *Merchant) isBuying(_ *City, good Good) (bool, float64) {
+	// no possible profit by buying and selling in same location
+	if good != merchant.BuysSells || merchant.bestSellLocation == merchant.city || merchant.Owned >= merchant.CarryingCapacity {
+		return false, 0
+	}
+	// and no profit buying this good for the best sell price or more
+	bestSellPrice := merchant.ExpectedPrices[good][merchant.bestSellLocation]
+	return true, math.Min(merchant.ExpectedPrices[good][merchant.city], math.Nextafter(bestSellPrice, math.Inf(-1)))
+}
+
 func (merchant *Merchant) transact(good Good, buying bool, price float64) {
 	if good != merchant.BuysSells {
 		fmt.Printf("Merchant somehow transacted a good they don't deal in")
@@ -155,36 +181,96 @@ func (merchant *Merchant) transact(good Good, buying bool, price float64) {
 	}
 }
 
-func (merchant *Merchant) gossip(good Good) float64 {
-	return merchant.ExpectedPrices[good][merchant.city]
+func (merchant *Merchant) gossip(good Good) (float64, bool) {
+	expected, ok := merchant.ExpectedPrices[good][merchant.city]
+	return expected, ok
+}
+
+func (merchant *Merchant) id() AgentID {
+	return merchant.ID
 }
 
-// find the best location to travel to and how much you would make selling a good there minus the travel expense.
-// returns sell location, expected sell price
-func (merchant *Merchant) bestDeal(good Good, city *City) (cityName, float64) {
+func (merchant *Merchant) kind() AgentKind {
+	return MerchantAgent
+}
+
+func (merchant *Merchant) balance() float64 {
+	return merchant.Money
+}
 
-	// considers nearby (connected) cities. Later, merchants can be more intelligent
-	bestSellLocation := merchant.city
+func (merchant *Merchant) addMoney(amount float64) {
+	merchant.Money += amount
+}
+
+func (merchant *Merchant) setDebt(city cityName, debt float64) {
+	if debt <= 0 {
+		delete(merchant.Debts, city)
+		return
+	}
+	if merchant.Debts == nil {
+		merchant.Debts = make(map[cityName]float64)
+	}
+	merchant.Debts[city] = debt
+}
+
+func (merchant *Merchant) strategy() string {
+	return string(MerchantAgent)
+}
+
+func (merchant *Merchant) holding(good Good) int {
+	if good != merchant.BuysSells {
+		return 0
+	}
+	return merchant.Owned
+}
+
+// find the best locations to buy a good and to sell it, and how much you would make minus the travel expense.
+// Only cities the merchant has heard a price from are considered. tripCosts come from allTripCosts.
+// returns buy location, sell location, expected profit per unit
+func (merchant *Merchant) bestDeal(good Good, city *City, tripCosts map[cityName]map[cityName]float64) (cityName, cityName, float64) {
+
+	// considers every city we know a route to, however many travel ways away. Staying put still costs the usual travel cost, per unit like any other trip
+	fromHere := map[cityName]float64{merchant.city: merchant.movingCost(city, merchant.city)}
+	for to, cost := range tripCosts[merchant.city] {
+		fromHere[to] = cost
+	}
+	possibleCities := append([]cityName{merchant.city}, sortedCityNames(tripCosts[merchant.city])...)
+
+	bestBuyLocation, bestSellLocation := merchant.city, merchant.city
 	bestProfit := 0.0
-	possibleCities := []cityName{merchant.city}
-	city.outboundTravelWays.Range(func(cityName cityName, _ chan *Merchant) bool {
-		possibleCities = append(possibleCities, cityName)
-		return true
-	})
 	for _, buyLocation := range possibleCities {
-		buyPrice := merchant.ExpectedPrices[good][buyLocation]
+		buyPrice, known := merchant.ExpectedPrices[good][buyLocation]
+		if !known {
+			continue
+		}
+
+		// buying somewhere else means getting there first, then carrying the goods on from there
+		costs := fromHere
+		if buyLocation != merchant.city {
+			costs = make(map[cityName]float64)
+			for sellLocation, cost := range tripCosts[buyLocation] {
+				costs[sellLocation] = fromHere[buyLocation] + cost
+			}
+		}
+
 		for _, sellLocation := range possibleCities {
-			sellPrice := merchant.ExpectedPrices[good][sellLocation]
-			// get moving costs, pretend it's 1 for now
-			movingCost := 1.0
+			sellPrice, known := merchant.ExpectedPrices[good][sellLocation]
+			if !known {
+				continue
+			}
+			movingCost, ok := costs[sellLocation]
+			if !ok {
+				continue // no known way from where we would buy
+			}
 
 			potentialProfit := sellPrice - (buyPrice + movingCost)
 			if potentialProfit > bestProfit {
+				bestBuyLocation = buyLocation
 				bestSellLocation = sellLocation
 				bestProfit = potentialProfit
 			}
 		}
 	}
 
-	return bestSellLocation, bestProfit
+	return bestBuyLocation, bestSellLocation, bestProfit
 }
@@ -0,0 +1,130 @@
+package economy
+
+import (
+	"fmt"
+	"sort"
+)
+
+// the agent kinds that can be added to a city by name, each adds one agent using the named belief rule ("" for its default)
+var agentKinds = map[string]func(city *City, beliefs string) error{
+	string(LocalAgent): func(city *City, beliefs string) error {
+		local := NewLocal(city.newID(LocalAgent), city.catalog, city.rng)
+		if beliefs != "" {
+			if err := local.SetBeliefRule(beliefs); err != nil {
+				return err
+			}
+		}
+		city.locals = append(city.locals, local)
+		return nil
+	},
+	string(MerchantAgent): func(city *City, beliefs string) error {
+		if beliefs != "" {
+			return fmt.Errorf("merchants don't use belief rules")
+		}
+		city.merchants = append(city.merchants, NewMerchant(city, city.catalog.merchantGood()))
+		return nil
+	},
+}
+
+// RegisterAgentKind makes an agent kind available by name, add must put one new agent in the city
+func RegisterAgentKind(kind string, add func(city *City, beliefs string) error) {
+	agentKinds[kind] = add
+}
+
+// AgentKinds returns the names of every registered agent kind
+func AgentKinds() []string {
+	names := make([]string, 0, len(agentKinds))
+	for name := range agentKinds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Population is a group of agents of the same kind, used to mix different kinds of agents in one city
+type Population struct {
+	Kind    string `json:"kind"`              // a registered agent kind
+	Count   int    `json:"count"`             // how many to add
+	Beliefs string `json:"beliefs,omitempty"` // a registered belief rule, defaults to the kind's own
+}
+
+// AddPopulation adds agents to the city
+func (city *City) AddPopulation(population Population) error {
+	add, ok := agentKinds[population.Kind]
+	if !ok {
+		return fmt.Errorf("unknown agent kind %q", population.Kind)
+	}
+	for i := 0; i < population.Count; i++ {
+		if err := add(city, population.Beliefs); err != nil {
+			return fmt.Errorf("adding %s: %w", population.Kind, err)
+		}
+	}
+	return nil
+}
+
+// Traders returns the traders currently in the city
+func (city *City) Traders() []*Trader {
+	return append([]*Trader{}, city.traders...)
+}
+
+// StrategyPerformance is how well the agents using one strategy are doing
+type StrategyPerformance struct {
+	Strategy     string
+	Agents       int
+	MeanMoney    float64
+	MeanNetWorth float64 // money plus goods valued at what the locals expect them to sell for
+	Trades       int     // bought and sold, from the ledger
+	MeanProfit   float64 // earned minus spent in the ledger, so only over the trades it still keeps
+}
+
+// StrategyReport compares the agents in the city by strategy, sorted by strategy name
+func (city *City) StrategyReport() []StrategyPerformance {
+	prices := make(map[Good]float64)
+	for _, good := range city.catalog.goods {
+		prices[good] = city.meanExpectedPrice(good)
+	}
+	profits := city.ledger.ProfitAndLoss()
+
+	byStrategy := make(map[string]*StrategyPerformance)
+	for _, agent := range city.allEconomicAgents() {
+		performance, ok := byStrategy[agent.strategy()]
+		if !ok {
+			performance = &StrategyPerformance{Strategy: agent.strategy()}
+			byStrategy[agent.strategy()] = performance
+		}
+
+		performance.Agents++
+		performance.MeanMoney += agent.balance()
+		performance.MeanNetWorth += agent.balance()
+		for _, good := range city.catalog.goods {
+			performance.MeanNetWorth += float64(agent.holding(good)) * prices[good]
+		}
+		if profit, ok := profits[agent.id()]; ok {
+			performance.Trades += profit.Bought + profit.Sold
+			performance.MeanProfit += profit.Net()
+		}
+	}
+
+	report := make([]StrategyPerformance, 0, len(byStrategy))
+	for _, performance := range byStrategy {
+		agents := float64(performance.Agents)
+		performance.MeanMoney /= agents
+		performance.MeanNetWorth /= agents
+		performance.MeanProfit /= agents
+		report = append(report, *performance)
+	}
+	sort.Slice(report, func(i, j int) bool { return report[i].Strategy < report[j].Strategy })
+	return report
+}
+
+// what the locals expect a good to sell for on average, 0 if there are no locals
+func (city *City) meanExpectedPrice(good Good) float64 {
+	if len(city.locals) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, local := range city.locals {
+		sum += local.markets[good].expectedMarketPrice
+	}
+	return sum / float64(len(city.locals))
+}
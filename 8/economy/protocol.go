@@ -0,0 +1,269 @@
+package economy
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// cities only talk to peers speaking the same protocol and version, anything else is refused during the hello
+const (
+	protocolName    = "simulated-economy"
+	protocolVersion = 3
+)
+
+// how long a peer has to say hello before we give up on them, and how long one message can take to write
+const (
+	handshakeTimeout = 10 * time.Second
+	writeTimeout     = 10 * time.Second
+)
+
+// The types of message sent over a networked travel way, one JSON envelope per line
+const (
+	messageHello    = "hello"    // the first message each side sends
+	messageMerchant = "merchant" // a merchant arriving from the peer
+	messageAck      = "ack"      // the peer let in the merchant we sent
+	messageRefused  = "refused"  // the peer will never let in the merchant we sent, they can come home
+	messageGossip   = "gossip"   // news about the peer's city
+	messagePing     = "ping"     // asks the peer to answer with a pong
+	messagePong     = "pong"
+	messageClose    = "close" // the peer is hanging up, and why
+)
+
+// what a city can do over a connection, only what both sides support is used
+const (
+	capabilityMerchants = "merchants"
+	capabilityGossip    = "gossip"
+	capabilityPing      = "ping"
+)
+
+var supportedCapabilities = []string{capabilityMerchants, capabilityGossip, capabilityPing}
+
+var errPeerClosed = errors.New("peer closed the connection")
+
+// envelope wraps every message. Seq counts the messages sent in one direction, and MAC signs them when the cities share a secret
+type envelope struct {
+	Type string          `json:"type"`
+	Seq  uint64          `json:"seq"`
+	Body json.RawMessage `json:"body,omitempty"`
+	MAC  string          `json:"mac,omitempty"`
+}
+
+type helloMessage struct {
+	Protocol     string   `json:"protocol"`
+	Version      int      `json:"version"`
+	City         cityName `json:"city"`
+	Goods        []Good   `json:"goods"`
+	Capabilities []string `json:"capabilities"`
+	Nonce        string   `json:"nonce"`  // makes every connection sign messages differently, so they can't be replayed on another
+	Signed       bool     `json:"signed"` // whether the city expects messages to be signed
+}
+
+type closeMessage struct {
+	Reason string `json:"reason"`
+}
+
+// peer is one end of a connection with another city, after a successful hello
+type peer struct {
+	connection net.Conn
+	reader     *bufio.Reader
+	writer     *bufio.Writer
+	writeMutex sync.Mutex
+
+	remote       helloMessage
+	capabilities map[string]bool // supported by both sides
+
+	secret              []byte // nil if messages aren't signed
+	sendKey, receiveKey []byte // derived from the secret and both nonces
+	sendSeq, receiveSeq uint64
+}
+
+// SetNetworkSecret makes the city sign everything it sends over networked travel ways, and refuse peers that don't share the secret.
+// An empty secret turns signing off. Only affects connections made afterwards
+func (city *City) SetNetworkSecret(secret string) {
+	city.networkSecret = []byte(secret)
+}
+
+// exchange hellos with the other side of a fresh connection, refusing them if they can't talk to us
+func handshake(connection net.Conn, city *City) (*peer, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	p := &peer{
+		connection: connection,
+		reader:     bufio.NewReader(connection),
+		writer:     bufio.NewWriter(connection),
+	}
+	if len(city.networkSecret) > 0 {
+		p.secret = city.networkSecret
+		p.sendKey = p.secret
+		p.receiveKey = p.secret
+	}
+
+	local := helloMessage{
+		Protocol:     protocolName,
+		Version:      protocolVersion,
+		City:         city.name,
+		Goods:        city.catalog.Goods(),
+		Capabilities: supportedCapabilities,
+		Nonce:        hex.EncodeToString(nonce),
+		Signed:       p.secret != nil,
+	}
+	if err := p.send(messageHello, local); err != nil {
+		return nil, err
+	}
+
+	connection.SetReadDeadline(time.Now().Add(handshakeTimeout))
+	message, err := p.receive()
+	connection.SetReadDeadline(time.Time{})
+	if errors.Is(err, errPeerClosed) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, p.refuse(fmt.Sprintf("no usable hello: %v", err))
+	}
+	if message.Type != messageHello {
+		return nil, p.refuse(fmt.Sprintf("expected %s, got %s", messageHello, message.Type))
+	}
+	if err := json.Unmarshal(message.Body, &p.remote); err != nil {
+		return nil, p.refuse(fmt.Sprintf("bad hello: %v", err))
+	}
+
+	if p.remote.Protocol != protocolName || p.remote.Version != protocolVersion {
+		return nil, p.refuse(fmt.Sprintf("can't speak %s version %d, only %s version %d", p.remote.Protocol, p.remote.Version, protocolName, protocolVersion))
+	}
+	if p.remote.Signed != local.Signed {
+		return nil, p.refuse("only one side has a network secret")
+	}
+	if !sameGoods(local.Goods, p.remote.Goods) {
+		return nil, p.refuse(fmt.Sprintf("goods differ, we trade %v and they trade %v", local.Goods, p.remote.Goods))
+	}
+	if p.remote.City == "" || p.remote.City == city.name {
+		return nil, p.refuse(fmt.Sprintf("peer has an unusable name %q", p.remote.City))
+	}
+
+	p.capabilities = make(map[string]bool)
+	for _, capability := range p.remote.Capabilities {
+		for _, supported := range supportedCapabilities {
+			if capability == supported {
+				p.capabilities[capability] = true
+			}
+		}
+	}
+	if !p.capabilities[capabilityMerchants] {
+		return nil, p.refuse("peer doesn't accept merchants")
+	}
+
+	// from now on each direction signs with its own key, tied to this connection
+	if p.secret != nil {
+		p.sendKey = sign(p.secret, "session", local.Nonce, p.remote.Nonce)
+		p.receiveKey = sign(p.secret, "session", p.remote.Nonce, local.Nonce)
+	}
+	return p, nil
+}
+
+// tell the peer why we are hanging up, returning the reason as an error
+func (p *peer) refuse(reason string) error {
+	p.send(messageClose, closeMessage{Reason: reason})
+	return errors.New(reason)
+}
+
+// safe to call from several goroutines, fails if the peer doesn't take the message within writeTimeout
+func (p *peer) send(messageType string, body interface{}) error {
+	bodyBytes, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	p.writeMutex.Lock()
+	defer p.writeMutex.Unlock()
+
+	message := envelope{Type: messageType, Seq: p.sendSeq, Body: bodyBytes}
+	if p.sendKey != nil {
+		message.MAC = hex.EncodeToString(sign(p.sendKey, strconv.FormatUint(message.Seq, 10), message.Type, string(message.Body)))
+	}
+	messageBytes, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	p.connection.SetWriteDeadline(time.Now().Add(writeTimeout)) // a peer that stopped reading can't hold us up forever
+	if err := writeAndFlush(p.writer, messageBytes); err != nil {
+		return err
+	}
+	p.sendSeq++
+	return nil
+}
+
+// blocks until the next message arrives. Messages out of order or with a bad signature are errors, as is the peer closing
+func (p *peer) receive() (envelope, error) {
+	line, err := p.reader.ReadBytes('\n')
+	if err != nil {
+		return envelope{}, err
+	}
+
+	message := envelope{}
+	if err := json.Unmarshal(line, &message); err != nil {
+		return envelope{}, fmt.Errorf("not a protocol message, is the peer running older code? %w", err)
+	}
+	if message.Type == "" {
+		return envelope{}, fmt.Errorf("message has no type, is the peer running older code?")
+	}
+	if message.Seq != p.receiveSeq {
+		return envelope{}, fmt.Errorf("expected message %d, got %d", p.receiveSeq, message.Seq)
+	}
+	if p.receiveKey != nil {
+		expected := sign(p.receiveKey, strconv.FormatUint(message.Seq, 10), message.Type, string(message.Body))
+		mac, err := hex.DecodeString(message.MAC)
+		if err != nil || !hmac.Equal(mac, expected) {
+			return envelope{}, fmt.Errorf("%s message has a bad signature", message.Type)
+		}
+	}
+	p.receiveSeq++
+
+	if message.Type == messageClose {
+		reason := closeMessage{}
+		json.Unmarshal(message.Body, &reason)
+		if reason.Reason != "" {
+			return envelope{}, fmt.Errorf("%w: %s", errPeerClosed, reason.Reason)
+		}
+		return envelope{}, errPeerClosed
+	}
+	return message, nil
+}
+
+func sign(key []byte, parts ...string) []byte {
+	mac := hmac.New(sha256.New, key)
+	for _, part := range parts {
+		mac.Write([]byte(part))
+		mac.Write([]byte{'\n'})
+	}
+	return mac.Sum(nil)
+}
+
+func sameGoods(a, b []Good) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sortedA := append([]Good{}, a...)
+	sortedB := append([]Good{}, b...)
+	sort.Slice(sortedA, func(i, j int) bool { return sortedA[i] < sortedA[j] })
+	sort.Slice(sortedB, func(i, j int) bool { return sortedB[i] < sortedB[j] })
+	for i := range sortedA {
+		if sortedA[i] != sortedB[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,113 @@
+package economy
+
+import (
+	"bufio"
+	"image/color"
+	"net"
+	"strings"
+	"testing"
+)
+
+func newTestPeer(connection net.Conn, remote cityName) *peer {
+	return &peer{
+		connection:   connection,
+		reader:       bufio.NewReader(connection),
+		writer:       bufio.NewWriter(connection),
+		remote:       helloMessage{City: remote},
+		capabilities: make(map[string]bool),
+	}
+}
+
+// a hello the city would accept from a peer called B
+func testHello(city *City, signed bool) helloMessage {
+	return helloMessage{
+		Protocol:     protocolName,
+		Version:      protocolVersion,
+		City:         "B",
+		Goods:        city.catalog.Goods(),
+		Capabilities: supportedCapabilities,
+		Nonce:        "00",
+		Signed:       signed,
+	}
+}
+
+// runs the city's side of a handshake against a peer that answers with hello, signed with secret if it isn't empty
+func handshakeWith(city *City, hello helloMessage, secret string) (*peer, error) {
+	connection, other := net.Pipe()
+	defer connection.Close()
+	defer other.Close()
+
+	remote := newTestPeer(other, city.name)
+	if secret != "" {
+		remote.sendKey = []byte(secret)
+	}
+	go func() {
+		remote.receive() // the city's hello, not checked
+		remote.send(messageHello, hello)
+		for {
+			if _, err := remote.receive(); err != nil {
+				return // the city hung up
+			}
+		}
+	}()
+	return handshake(connection, city)
+}
+
+func TestHandshake(t *testing.T) {
+	city := NewCity("A", color.White, 0, 1)
+	peer, err := handshakeWith(city, testHello(city, false), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if peer.remote.City != "B" {
+		t.Errorf("peer is called %s, expected B", peer.remote.City)
+	}
+	for _, capability := range supportedCapabilities {
+		if !peer.capabilities[capability] {
+			t.Errorf("both sides support %s but it isn't used", capability)
+		}
+	}
+}
+
+func TestHandshakeRefuses(t *testing.T) {
+	city := NewCity("A", color.White, 0, 1)
+	cases := []struct {
+		name   string
+		change func(*helloMessage)
+		reason string
+	}{
+		{"older version", func(hello *helloMessage) { hello.Version = protocolVersion - 1 }, "version"},
+		{"other protocol", func(hello *helloMessage) { hello.Protocol = "something else" }, "version"},
+		{"other goods", func(hello *helloMessage) { hello.Goods = hello.Goods[1:] }, "goods differ"},
+		{"same name", func(hello *helloMessage) { hello.City = "A" }, "unusable name"},
+		{"no merchants", func(hello *helloMessage) { hello.Capabilities = []string{capabilityGossip} }, "merchants"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			hello := testHello(city, false)
+			c.change(&hello)
+			_, err := handshakeWith(city, hello, "")
+			if err == nil {
+				t.Fatal("handshake succeeded")
+			}
+			if !strings.Contains(err.Error(), c.reason) {
+				t.Errorf("refused with %q, expected it to mention %q", err, c.reason)
+			}
+		})
+	}
+}
+
+func TestHandshakeSecrets(t *testing.T) {
+	city := NewCity("A", color.White, 0, 1)
+	city.SetNetworkSecret("open sesame")
+
+	if _, err := handshakeWith(city, testHello(city, true), "open sesame"); err != nil {
+		t.Errorf("refused a peer with the same secret: %v", err)
+	}
+	if _, err := handshakeWith(city, testHello(city, true), "something else"); err == nil || !strings.Contains(err.Error(), "signature") {
+		t.Errorf("expected a peer with another secret to be refused for a bad signature, got %v", err)
+	}
+	if _, err := handshakeWith(city, testHello(city, false), ""); err == nil {
+		t.Error("accepted a peer without a secret")
+	}
+}
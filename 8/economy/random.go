@@ -0,0 +1,51 @@
+package economy
+
+import (
+	"math/bits"
+)
+
+// savableSource is a xoshiro256** generator. The sources of math/rand hide their state,
+// this one is only four numbers, so a snapshot can store them and put the generator back exactly where it was
+type savableSource struct {
+	state [4]uint64
+}
+
+func newSavableSource(seed int64) *savableSource {
+	source := &savableSource{}
+	source.Seed(seed)
+	return source
+}
+
+// restoreSavableSource recreates a source from the state it saved
+func restoreSavableSource(state [4]uint64) *savableSource {
+	return &savableSource{state: state}
+}
+
+func (source *savableSource) Int63() int64 {
+	return int64(source.Uint64() >> 1)
+}
+
+func (source *savableSource) Uint64() uint64 {
+	state := &source.state
+	result := bits.RotateLeft64(state[1]*5, 7) * 9
+	shifted := state[1] << 17
+	state[2] ^= state[0]
+	state[3] ^= state[1]
+	state[1] ^= state[2]
+	state[0] ^= state[3]
+	state[2] ^= shifted
+	state[3] = bits.RotateLeft64(state[3], 45)
+	return result
+}
+
+// Seed spreads the seed over the whole state with splitmix64, so similar seeds still give unrelated numbers
+func (source *savableSource) Seed(seed int64) {
+	x := uint64(seed)
+	for i := range source.state {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		source.state[i] = z ^ (z >> 31)
+	}
+}
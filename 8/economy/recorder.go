@@ -0,0 +1,421 @@
+package economy
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Snapshot is the state of one city at the end of a tick
+type Snapshot struct {
+	Tick        int
+	City        string
+	Locals      int
+	Merchants   int
+	Travelling  int     // merchants on their way to the city
+	MoneySupply float64 // money held by locals, merchants, traders and firms in the city
+	Goods       map[Good]GoodSnapshot
+
+	Taxes TaxReport
+	Bank  BankReport // all 0 if the city has no bank
+
+	Monetary MonetaryReport // all 0 if the city has no central bank
+	Labor    LaborReport    // all 0 if the city has no labor market
+
+	Firms        int
+	Firm         FirmReport // summed over the city's firms
+	Bankruptcies int        // firms that closed during the tick
+
+	Demography DemographyReport
+
+	BulletinsHeard int // price bulletins the city's merchants listened to during the tick
+
+	Metrics []float64 // one for each metric added to the recorder, in the order they were added
+
+	Interventions []string // applied to the city during the tick
+}
+
+// GoodSnapshot is the state of one good in a city at the end of a tick
+type GoodSnapshot struct {
+	MinPrice, MaxPrice, MeanPrice, MedianPrice float64 // of the locals' expected market prices
+
+	TradeVolume       int     // trades made during the tick
+	AverageTradePrice float64 // 0 if there were no trades
+
+	Stock     int // owned by locals, merchants, traders and firms
+	Merchants int // merchants that buy and sell this good
+
+	Resource      float64 // size of the population the good is harvested from, 0 if it isn't harvested
+	HarvestChance float64 // chance harvesting one unit succeeds, 1 if the good isn't harvested
+}
+
+// Recorder keeps a snapshot of every city at every tick so runs can be analysed afterwards.
+// Attach it with simulation.OnTick(recorder.Record)
+type Recorder struct {
+	snapshots []Snapshot
+
+	metricNames []string
+	metrics     []func(*City) []float64 // each returns one value per name
+
+	goods []Good // the goods of the simulation recorded, each gets its own columns
+}
+
+// NewRecorder creates an empty recorder
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// AddMetrics records extra values for every city, compute must return one value for each name.
+// Must be called before anything is recorded
+func (recorder *Recorder) AddMetrics(names []string, compute func(*City) []float64) {
+	recorder.metricNames = append(recorder.metricNames, names...)
+	recorder.metrics = append(recorder.metrics, func(city *City) []float64 {
+		values := compute(city)
+		if len(values) != len(names) {
+			panic(fmt.Sprintf("metrics %v returned %d values", names, len(values)))
+		}
+		return values
+	})
+}
+
+// Record takes a snapshot of every city in the simulation
+func (recorder *Recorder) Record(simulation *Simulation) {
+	if recorder.goods == nil {
+		recorder.goods = simulation.Goods()
+	}
+	for _, city := range simulation.cities {
+		snapshot := takeSnapshot(simulation.tick, city)
+		for _, metric := range recorder.metrics {
+			snapshot.Metrics = append(snapshot.Metrics, metric(city)...)
+		}
+		for _, applied := range simulation.interventions {
+			if applied.Tick == simulation.tick && applied.City == snapshot.City {
+				snapshot.Interventions = append(snapshot.Interventions, applied.Intervention.String())
+			}
+		}
+		recorder.snapshots = append(recorder.snapshots, snapshot)
+	}
+}
+
+// Snapshots returns everything recorded so far, in the order it was recorded
+func (recorder *Recorder) Snapshots() []Snapshot {
+	return recorder.snapshots
+}
+
+func takeSnapshot(tick int, city *City) Snapshot {
+	snapshot := Snapshot{
+		Tick:       tick,
+		City:       string(city.name),
+		Locals:     len(city.locals),
+		Merchants:  len(city.merchants),
+		Travelling: len(city.travelling),
+		Goods:      make(map[Good]GoodSnapshot),
+		Taxes:      city.lastTaxReport,
+		Labor:      city.LaborReport(),
+
+		Firms:        len(city.firms),
+		Bankruptcies: city.lastBankruptcies,
+		Demography:   city.lastDemographics,
+
+		BulletinsHeard: city.lastBulletinsHeard,
+	}
+	if city.bank != nil {
+		snapshot.Bank = city.bank.lastReport
+	}
+	if city.centralBank != nil {
+		snapshot.Monetary = city.centralBank.report
+	}
+
+	for _, local := range city.locals {
+		snapshot.MoneySupply += local.money
+	}
+	for _, merchant := range city.merchants {
+		snapshot.MoneySupply += merchant.Money
+	}
+	for _, trader := range city.traders {
+		snapshot.MoneySupply += trader.money
+	}
+	for _, firm := range city.firms {
+		snapshot.MoneySupply += firm.money
+		snapshot.Firm.Revenue += firm.lastReport.Revenue
+		snapshot.Firm.Costs += firm.lastReport.Costs
+		snapshot.Firm.Purchases += firm.lastReport.Purchases
+		snapshot.Firm.Profit += firm.lastReport.Profit
+		snapshot.Firm.Produced += firm.lastReport.Produced
+		snapshot.Firm.Sold += firm.lastReport.Sold
+	}
+
+	for _, good := range city.catalog.goods {
+		goodSnapshot := GoodSnapshot{}
+
+		prices := make([]float64, 0, len(city.locals))
+		for _, local := range city.locals {
+			prices = append(prices, local.markets[good].expectedMarketPrice)
+			goodSnapshot.Stock += local.markets[good].ownedGoods
+		}
+		goodSnapshot.MinPrice, goodSnapshot.MaxPrice, goodSnapshot.MeanPrice, goodSnapshot.MedianPrice = summarize(prices)
+
+		if tally, ok := city.trades[good]; ok && tally.Count > 0 {
+			goodSnapshot.TradeVolume = tally.Count
+			goodSnapshot.AverageTradePrice = tally.Value / float64(tally.Count)
+		}
+
+		for _, merchant := range city.merchants {
+			if merchant.BuysSells == good {
+				goodSnapshot.Merchants++
+				goodSnapshot.Stock += merchant.Owned
+			}
+		}
+		for _, trader := range city.traders {
+			goodSnapshot.Stock += trader.owned[good]
+		}
+		for _, firm := range city.firms {
+			goodSnapshot.Stock += firm.inventory[good]
+		}
+
+		if resource, ok := city.resource(good); ok {
+			goodSnapshot.Resource = city.ecosystem.Population(resource.Population)
+		}
+		goodSnapshot.HarvestChance = city.harvestChance(good)
+
+		snapshot.Goods[good] = goodSnapshot
+	}
+
+	return snapshot
+}
+
+// returns min, max, mean and median, all 0 if there are no values
+func summarize(values []float64) (float64, float64, float64, float64) {
+	if len(values) == 0 {
+		return 0, 0, 0, 0
+	}
+
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+
+	sum := 0.0
+	for _, v := range sorted {
+		sum += v
+	}
+
+	median := sorted[len(sorted)/2]
+	if len(sorted)%2 == 0 {
+		median = (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+	}
+
+	return sorted[0], sorted[len(sorted)-1], sum / float64(len(sorted)), median
+}
+
+// a column of the recorded data, every snapshot is a row
+type column struct {
+	name    string
+	integer func(Snapshot) int64
+	float   func(Snapshot) float64
+	text    func(Snapshot) string
+}
+
+// one row per snapshot, the per-good columns are named good_field
+func (recorder *Recorder) columns() []column {
+	columns := []column{
+		{name: "tick", integer: func(s Snapshot) int64 { return int64(s.Tick) }},
+		{name: "city", text: func(s Snapshot) string { return s.City }},
+		{name: "locals", integer: func(s Snapshot) int64 { return int64(s.Locals) }},
+		{name: "merchants", integer: func(s Snapshot) int64 { return int64(s.Merchants) }},
+		{name: "merchants_travelling", integer: func(s Snapshot) int64 { return int64(s.Travelling) }},
+		{name: "money_supply", float: func(s Snapshot) float64 { return s.MoneySupply }},
+		{name: "income_tax", float: func(s Snapshot) float64 { return s.Taxes.Income }},
+		{name: "sales_tax", float: func(s Snapshot) float64 { return s.Taxes.Sales }},
+		{name: "wealth_tax", float: func(s Snapshot) float64 { return s.Taxes.Wealth }},
+		{name: "entry_tolls", float: func(s Snapshot) float64 { return s.Taxes.Tolls }},
+		{name: "fares", float: func(s Snapshot) float64 { return s.Taxes.Fares }},
+		{name: "transfers", float: func(s Snapshot) float64 { return s.Taxes.Transfers }},
+		{name: "treasury", float: func(s Snapshot) float64 { return s.Taxes.Treasury }},
+		{name: "bank_reserves", float: func(s Snapshot) float64 { return s.Bank.Reserves }},
+		{name: "bank_deposits", float: func(s Snapshot) float64 { return s.Bank.Deposits }},
+		{name: "bank_loans", float: func(s Snapshot) float64 { return s.Bank.Loans }},
+		{name: "bank_lent", float: func(s Snapshot) float64 { return s.Bank.Lent }},
+		{name: "bank_repaid", float: func(s Snapshot) float64 { return s.Bank.Repaid }},
+		{name: "bank_interest_earned", float: func(s Snapshot) float64 { return s.Bank.InterestEarned }},
+		{name: "bank_interest_paid", float: func(s Snapshot) float64 { return s.Bank.InterestPaid }},
+		{name: "bank_defaults", integer: func(s Snapshot) int64 { return int64(s.Bank.Defaults) }},
+		{name: "bank_written_off", float: func(s Snapshot) float64 { return s.Bank.WrittenOff }},
+		{name: "price_index", float: func(s Snapshot) float64 { return s.Monetary.PriceIndex }},
+		{name: "inflation", float: func(s Snapshot) float64 { return s.Monetary.Inflation }},
+		{name: "money_created", float: func(s Snapshot) float64 { return s.Monetary.Created }},
+		{name: "hires", integer: func(s Snapshot) int64 { return int64(s.Labor.Hires) }},
+		{name: "employers", integer: func(s Snapshot) int64 { return int64(s.Labor.Employers) }},
+		{name: "average_wage", float: func(s Snapshot) float64 { return s.Labor.AverageWage }},
+		{name: "unfilled_jobs", integer: func(s Snapshot) int64 { return int64(s.Labor.Unfilled) }},
+		{name: "firms", integer: func(s Snapshot) int64 { return int64(s.Firms) }},
+		{name: "firm_revenue", float: func(s Snapshot) float64 { return s.Firm.Revenue }},
+		{name: "firm_costs", float: func(s Snapshot) float64 { return s.Firm.Costs }},
+		{name: "firm_purchases", float: func(s Snapshot) float64 { return s.Firm.Purchases }},
+		{name: "firm_profit", float: func(s Snapshot) float64 { return s.Firm.Profit }},
+		{name: "firm_produced", integer: func(s Snapshot) int64 { return int64(s.Firm.Produced) }},
+		{name: "firm_sold", integer: func(s Snapshot) int64 { return int64(s.Firm.Sold) }},
+		{name: "bankruptcies", integer: func(s Snapshot) int64 { return int64(s.Bankruptcies) }},
+		{name: "births", integer: func(s Snapshot) int64 { return int64(s.Demography.Births) }},
+		{name: "deaths", integer: func(s Snapshot) int64 { return int64(s.Demography.Deaths) }},
+		{name: "emigrants", integer: func(s Snapshot) int64 { return int64(s.Demography.Emigrants) }},
+		{name: "immigrants", integer: func(s Snapshot) int64 { return int64(s.Demography.Immigrants) }},
+		{name: "inherited", float: func(s Snapshot) float64 { return s.Demography.Inherited }},
+		{name: "bulletins_heard", integer: func(s Snapshot) int64 { return int64(s.BulletinsHeard) }},
+	}
+
+	for _, good := range recorder.goods {
+		good := good
+		columns = append(columns,
+			column{name: string(good) + "_min_price", float: func(s Snapshot) float64 { return s.Goods[good].MinPrice }},
+			column{name: string(good) + "_max_price", float: func(s Snapshot) float64 { return s.Goods[good].MaxPrice }},
+			column{name: string(good) + "_mean_price", float: func(s Snapshot) float64 { return s.Goods[good].MeanPrice }},
+			column{name: string(good) + "_median_price", float: func(s Snapshot) float64 { return s.Goods[good].MedianPrice }},
+			column{name: string(good) + "_trade_volume", integer: func(s Snapshot) int64 { return int64(s.Goods[good].TradeVolume) }},
+			column{name: string(good) + "_average_trade_price", float: func(s Snapshot) float64 { return s.Goods[good].AverageTradePrice }},
+			column{name: string(good) + "_stock", integer: func(s Snapshot) int64 { return int64(s.Goods[good].Stock) }},
+			column{name: string(good) + "_merchants", integer: func(s Snapshot) int64 { return int64(s.Goods[good].Merchants) }},
+			column{name: string(good) + "_resource", float: func(s Snapshot) float64 { return s.Goods[good].Resource }},
+			column{name: string(good) + "_harvest_chance", float: func(s Snapshot) float64 { return s.Goods[good].HarvestChance }},
+		)
+	}
+
+	for i, name := range recorder.metricNames {
+		i := i
+		columns = append(columns, column{name: name, float: func(s Snapshot) float64 { return s.Metrics[i] }})
+	}
+
+	columns = append(columns, column{name: "interventions", text: func(s Snapshot) string { return strings.Join(s.Interventions, "; ") }})
+
+	return columns
+}
+
+// WriteCSV writes every snapshot as a row of a CSV file with a header
+func (recorder *Recorder) WriteCSV(writer io.Writer) error {
+	columns := recorder.columns()
+	csvWriter := csv.NewWriter(writer)
+
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.name
+	}
+	if err := csvWriter.Write(header); err != nil {
+		return err
+	}
+
+	row := make([]string, len(columns))
+	for _, snapshot := range recorder.snapshots {
+		for i, column := range columns {
+			switch {
+			case column.integer != nil:
+				row[i] = strconv.FormatInt(column.integer(snapshot), 10)
+			case column.float != nil:
+				row[i] = strconv.FormatFloat(column.float(snapshot), 'g', -1, 64)
+			default:
+				row[i] = column.text(snapshot)
+			}
+		}
+		if err := csvWriter.Write(row); err != nil {
+			return err
+		}
+	}
+
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// the columnar file starts with this, the last byte is the format version
+var columnarMagic = []byte{'E', 'C', 'O', 'N', 'C', 'O', 'L', 1}
+
+// column types in the columnar file
+const (
+	columnInt64   byte = 0
+	columnFloat64 byte = 1
+	columnString  byte = 2
+)
+
+// WriteColumnar writes the snapshots in a compact binary format where each column is stored contiguously.
+// All numbers are little endian:
+//
+//	magic "ECONCOL" followed by the version byte 1
+//	uint64 row count, uint32 column count
+//	for each column: uint16 name length, name, type byte (0 int64, 1 float64, 2 string)
+//	for each column: row count values. Strings are a uint32 length followed by the bytes
+//
+// See readColumnar.py for loading the file into pandas
+func (recorder *Recorder) WriteColumnar(writer io.Writer) error {
+	columns := recorder.columns()
+	buffered := bufio.NewWriter(writer)
+
+	write := func(data interface{}) error {
+		return binary.Write(buffered, binary.LittleEndian, data)
+	}
+
+	if _, err := buffered.Write(columnarMagic); err != nil {
+		return err
+	}
+	if err := write(uint64(len(recorder.snapshots))); err != nil {
+		return err
+	}
+	if err := write(uint32(len(columns))); err != nil {
+		return err
+	}
+
+	for _, column := range columns {
+		if len(column.name) > math.MaxUint16 {
+			return fmt.Errorf("column name %s is too long", column.name)
+		}
+		columnType := columnString
+		if column.integer != nil {
+			columnType = columnInt64
+		} else if column.float != nil {
+			columnType = columnFloat64
+		}
+		if err := write(uint16(len(column.name))); err != nil {
+			return err
+		}
+		if _, err := buffered.WriteString(column.name); err != nil {
+			return err
+		}
+		if err := write(columnType); err != nil {
+			return err
+		}
+	}
+
+	for _, column := range columns {
+		switch {
+		case column.integer != nil:
+			values := make([]int64, len(recorder.snapshots))
+			for i, snapshot := range recorder.snapshots {
+				values[i] = column.integer(snapshot)
+			}
+			if err := write(values); err != nil {
+				return err
+			}
+		case column.float != nil:
+			values := make([]float64, len(recorder.snapshots))
+			for i, snapshot := range recorder.snapshots {
+				values[i] = column.float(snapshot)
+			}
+			if err := write(values); err != nil {
+				return err
+			}
+		default:
+			for _, snapshot := range recorder.snapshots {
+				text := column.text(snapshot)
+				if err := write(uint32(len(text))); err != nil {
+					return err
+				}
+				if _, err := buffered.WriteString(text); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return buffered.Flush()
+}
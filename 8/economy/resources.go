@@ -0,0 +1,150 @@
+package economy
+
+import (
+	"fmt"
+
+	"github.com/jasonfantl/SimulatedEconomy8/ecology"
+)
+
+// Resource is a good harvested from a population of the city's ecosystem, like wood from trees or fur from rabbits
+type Resource struct {
+	Good       Good    `json:"good"`
+	Population string  `json:"population"`
+	PerUnit    float64 `json:"perUnit"`          // how much of the population one unit of the good takes
+	HalfAt     float64 `json:"halfAt,omitempty"` // harvesting succeeds half the time when the population is this big, 0 always succeeds while there is enough
+}
+
+// The counts an ecosystem population can be driven by
+const (
+	DriverLocals    = "locals"
+	DriverMerchants = "merchants"
+	DriverFirms     = "firms"
+)
+
+// EcologyPolicy gives a city an ecosystem that steps once every tick, and says which goods are harvested from it
+type EcologyPolicy struct {
+	Ecosystem ecology.Config    `json:"ecosystem"`
+	Resources []Resource        `json:"resources"`
+	Drivers   map[string]string `json:"drivers,omitempty"` // populations set to how many locals, merchants or firms are in the city before every step
+}
+
+// Validate checks the policy makes sense with the goods of the catalog
+func (policy EcologyPolicy) Validate(catalog *Catalog) error {
+	if err := policy.Ecosystem.Validate(); err != nil {
+		return err
+	}
+	harvested := make(map[Good]bool)
+	for _, resource := range policy.Resources {
+		if !catalog.tradable(resource.Good) {
+			return fmt.Errorf("resource has unknown good %s", resource.Good)
+		}
+		if harvested[resource.Good] {
+			return fmt.Errorf("%s is harvested from more than one population", resource.Good)
+		}
+		harvested[resource.Good] = true
+		if resource.Population == "" {
+			return fmt.Errorf("%s isn't harvested from any population", resource.Good)
+		}
+		if resource.PerUnit < 0 || resource.HalfAt < 0 {
+			return fmt.Errorf("%s: per unit and half at can't be negative", resource.Good)
+		}
+	}
+	for population, driver := range policy.Drivers {
+		switch driver {
+		case DriverLocals, DriverMerchants, DriverFirms:
+		default:
+			return fmt.Errorf("population %s has unknown driver %q", population, driver)
+		}
+	}
+	return nil
+}
+
+// SetEcology gives the city a new ecosystem, every population starts at its initial size
+func (city *City) SetEcology(policy EcologyPolicy) error {
+	if err := policy.Validate(city.catalog); err != nil {
+		return err
+	}
+	ecosystem, err := ecology.New(policy.Ecosystem)
+	if err != nil {
+		return err
+	}
+	city.ecology = &policy
+	city.ecosystem = ecosystem
+	return nil
+}
+
+// Ecosystem returns the city's ecosystem, nil if it doesn't have one
+func (city *City) Ecosystem() *ecology.Ecosystem {
+	return city.ecosystem
+}
+
+func (city *City) resource(good Good) (Resource, bool) {
+	if city.ecology == nil {
+		return Resource{}, false
+	}
+	for _, resource := range city.ecology.Resources {
+		if resource.Good == good {
+			return resource, true
+		}
+	}
+	return Resource{}, false
+}
+
+// the chance harvesting one unit of a good succeeds, harder the less there is left. Goods that aren't harvested always succeed
+func (city *City) harvestChance(good Good) float64 {
+	resource, ok := city.resource(good)
+	if !ok {
+		return 1
+	}
+	stock := city.ecosystem.Population(resource.Population)
+	if stock < resource.PerUnit || stock <= 0 {
+		return 0
+	}
+	if resource.HalfAt == 0 {
+		return 1
+	}
+	return stock / (stock + resource.HalfAt)
+}
+
+// how many units of a good one production action is expected to make
+func (city *City) expectedYield(good Good, count int) float64 {
+	made := count * city.productivity(good)
+	if _, ok := city.resource(good); !ok {
+		return float64(made)
+	}
+	return float64(made) * city.harvestChance(good)
+}
+
+// makes count units of a good, taking them from the ecosystem if the good is harvested. Returns how many were made
+func (city *City) harvest(good Good, count int) int {
+	resource, ok := city.resource(good)
+	if !ok {
+		return count
+	}
+	made := 0
+	for i := 0; i < count; i++ {
+		if city.rng.Float64() < city.harvestChance(good) {
+			city.ecosystem.Harvest(resource.Population, resource.PerUnit)
+			made++
+		}
+	}
+	return made
+}
+
+// moves the ecosystem forward, called at the end of every tick
+func (city *City) stepEcology() {
+	if city.ecosystem == nil {
+		return
+	}
+	for population, driver := range city.ecology.Drivers {
+		switch driver {
+		case DriverLocals:
+			city.ecosystem.Set(population, float64(len(city.locals)))
+		case DriverMerchants:
+			city.ecosystem.Set(population, float64(len(city.merchants)))
+		case DriverFirms:
+			city.ecosystem.Set(population, float64(len(city.firms)))
+		}
+	}
+	city.ecosystem.Step()
+}
@@ -0,0 +1,139 @@
+package economy
+
+import (
+	"sort"
+)
+
+// what it costs the merchant to carry one unit of their good to another city. Travel costs are for the whole trip,
+// whether it is a fare paid for a distance or one set directly, so a full load shares it
+func (merchant *Merchant) movingCost(city *City, to cityName) float64 {
+	if merchant.CarryingCapacity <= 0 {
+		return city.travelCost(to)
+	}
+	return city.travelCost(to) / float64(merchant.CarryingCapacity)
+}
+
+// remember where you can go from here and what it costs, forgetting travel ways that have closed
+func (merchant *Merchant) learnRoutes(city *City) {
+	if merchant.Routes == nil {
+		merchant.Routes = make(map[cityName]map[cityName]float64)
+	}
+	routes := make(map[cityName]float64)
+	for _, to := range city.outboundTravelWays.Names() {
+		routes[to] = merchant.movingCost(city, to)
+	}
+	merchant.Routes[city.name] = routes
+}
+
+// the cheapest known way to every city the merchant knows how to reach from here, by the cost of the whole trip.
+// Each path lists the cities to pass through, ending at the destination
+func (merchant *Merchant) shortestPaths(from cityName) (map[cityName]float64, map[cityName][]cityName) {
+	costs := map[cityName]float64{from: 0}
+	paths := map[cityName][]cityName{from: {}}
+	visited := make(map[cityName]bool)
+
+	for {
+		// closest city not yet visited, ties go to the first name so plans are always the same
+		current, found := cityName(""), false
+		for name, cost := range costs {
+			if visited[name] {
+				continue
+			}
+			if !found || cost < costs[current] || (cost == costs[current] && name < current) {
+				current, found = name, true
+			}
+		}
+		if !found {
+			break
+		}
+		visited[current] = true
+
+		for _, next := range sortedCityNames(merchant.Routes[current]) {
+			cost := costs[current] + merchant.Routes[current][next]
+			if known, ok := costs[next]; !ok || cost < known {
+				costs[next] = cost
+				paths[next] = append(append([]cityName{}, paths[current]...), next)
+			}
+		}
+	}
+
+	delete(costs, from)
+	delete(paths, from)
+	return costs, paths
+}
+
+// the travel way to take towards a city, following our plan if it still goes there
+func (merchant *Merchant) nextHop(city *City, destination cityName) (cityName, chan *Merchant, bool) {
+	if len(merchant.Plan) == 0 || merchant.Plan[len(merchant.Plan)-1] != destination {
+		_, paths := merchant.shortestPaths(city.name)
+		merchant.Plan = paths[destination]
+	}
+	if len(merchant.Plan) == 0 {
+		return "", nil, false
+	}
+	outboundTravelWay, ok := city.outboundTravelWays.Load(merchant.Plan[0])
+	if !ok {
+		merchant.Plan = nil // the road we planned on is gone
+		return "", nil, false
+	}
+	return merchant.Plan[0], outboundTravelWay, true
+}
+
+// we reached the next city on our plan, or wandered somewhere it didn't take us
+func (merchant *Merchant) followPlan(city *City) {
+	if len(merchant.Plan) > 0 && merchant.Plan[0] == city.name {
+		merchant.Plan = merchant.Plan[1:]
+	} else {
+		merchant.Plan = nil
+	}
+	if len(merchant.Plan) == 0 {
+		merchant.Plan = nil
+	}
+}
+
+func sortedCityNames(routes map[cityName]float64) []cityName {
+	names := make([]cityName, 0, len(routes))
+	for name := range routes {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
+
+// what it costs to carry a unit from every city the merchant knows routes out of to every city they can reach from it,
+// by the cheapest known way. Staying in the same city isn't a trip, so it has no cost
+func (merchant *Merchant) allTripCosts() map[cityName]map[cityName]float64 {
+	cities := make(map[cityName]float64)
+	costs := make(map[cityName]map[cityName]float64)
+	for from, routes := range merchant.Routes {
+		cities[from] = 0
+		costs[from] = make(map[cityName]float64)
+		for to, cost := range routes {
+			cities[to] = 0
+			if to != from {
+				costs[from][to] = cost
+			}
+		}
+	}
+	names := sortedCityNames(cities)
+
+	// Floyd-Warshall, in a fixed order so the sums always come out the same
+	for _, through := range names {
+		for _, from := range names {
+			toThrough, ok := costs[from][through]
+			if !ok {
+				continue
+			}
+			for _, to := range names {
+				onwards, ok := costs[through][to]
+				if !ok || to == from {
+					continue
+				}
+				if cost, known := costs[from][to]; !known || toThrough+onwards < cost {
+					costs[from][to] = toThrough + onwards
+				}
+			}
+		}
+	}
+	return costs
+}
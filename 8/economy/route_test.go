@@ -0,0 +1,71 @@
+package economy
+
+import (
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+func TestShortestPaths(t *testing.T) {
+	merchant := &Merchant{Routes: map[cityName]map[cityName]float64{
+		"A": {"B": 1, "C": 5},
+		"B": {"A": 1, "C": 1, "D": 10},
+		"C": {"D": 1},
+		"E": {"A": 1}, // can't be reached from A
+	}}
+
+	costs, paths := merchant.shortestPaths("A")
+	expectedCosts := map[cityName]float64{"B": 1, "C": 2, "D": 3}
+	expectedPaths := map[cityName][]cityName{"B": {"B"}, "C": {"B", "C"}, "D": {"B", "C", "D"}}
+	if !reflect.DeepEqual(costs, expectedCosts) {
+		t.Errorf("costs are %v, expected %v", costs, expectedCosts)
+	}
+	if !reflect.DeepEqual(paths, expectedPaths) {
+		t.Errorf("paths are %v, expected %v", paths, expectedPaths)
+	}
+}
+
+func TestShortestPathsBreaksTiesByName(t *testing.T) {
+	merchant := &Merchant{Routes: map[cityName]map[cityName]float64{
+		"A": {"C": 1, "B": 1},
+		"B": {"D": 1},
+		"C": {"D": 1},
+	}}
+	for i := 0; i < 20; i++ {
+		if _, paths := merchant.shortestPaths("A"); !reflect.DeepEqual(paths["D"], []cityName{"B", "D"}) {
+			t.Fatalf("went through %v, expected the tie to go to B", paths["D"])
+		}
+	}
+}
+
+func TestAllTripCostsMatchShortestPaths(t *testing.T) {
+	merchant := &Merchant{Routes: map[cityName]map[cityName]float64{
+		"A": {"B": 1, "C": 5},
+		"B": {"A": 1, "C": 1, "D": 10},
+		"C": {"D": 1, "A": 0.5},
+		"D": {"B": 2},
+	}}
+	tripCosts := merchant.allTripCosts()
+	for from := range merchant.Routes {
+		costs, _ := merchant.shortestPaths(from)
+		if !reflect.DeepEqual(tripCosts[from], costs) {
+			t.Errorf("from %s trips cost %v, shortest paths cost %v", from, tripCosts[from], costs)
+		}
+	}
+}
+
+func TestMovingCostIsPerUnitOnEveryRoad(t *testing.T) {
+	city := NewCity("A", color.White, 2, 1)
+	city.SetTravelCost("B", 40)
+	if err := city.SetDistance("C", 10); err != nil {
+		t.Fatal(err)
+	}
+	city.SetTravelCost("C", 40)
+	merchant := &Merchant{CarryingCapacity: 20}
+
+	for _, to := range []cityName{"B", "C"} {
+		if cost := merchant.movingCost(city, to); cost != 2 {
+			t.Errorf("carrying a unit to %s costs %v, expected 40 shared by 20 units", to, cost)
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package economy
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"io"
+	"os"
+)
+
+// Scenario describes an experiment: which cities exist, how they are connected, and what happens to them over time
+type Scenario struct {
+	Seed       int64               `json:"seed"`
+	Ticks      int                 `json:"ticks"`
+	Goods      []GoodDefinition    `json:"goods,omitempty"`   // defaults to DefaultGoods
+	Recipes    []Recipe            `json:"recipes,omitempty"` // defaults to DefaultRecipes
+	Market     string              `json:"market,omitempty"`  // the market mechanism of every city, "search" (default) or "auction"
+	Transit    *TransitPolicy      `json:"transit,omitempty"` // of every city, defaults to DefaultTransitPolicy
+	Cities     []ScenarioCity      `json:"cities"`
+	TravelWays []ScenarioTravelWay `json:"travelWays"`
+	Events     []ScenarioEvent     `json:"events"`
+}
+
+// ScenarioCity declares a city
+type ScenarioCity struct {
+	Name        string            `json:"name"`
+	Color       [4]uint8          `json:"color"` // RGBA
+	Size        int               `json:"size"`
+	Specialty   Good              `json:"specialty,omitempty"`
+	Specialized bool              `json:"specialized,omitempty"`
+	TaxPolicy   *TaxPolicy        `json:"taxPolicy,omitempty"`  // defaults to DefaultTaxPolicy
+	Market      string            `json:"market,omitempty"`     // overrides the scenario's market mechanism
+	Population  []Population      `json:"population,omitempty"` // agents added on top of the Size locals and Size/2 merchants
+	Bank        *BankPolicy       `json:"bank,omitempty"`       // opens a bank in the city
+	Monetary    *MonetaryPolicy   `json:"monetary,omitempty"`   // opens a central bank in the city
+	Labor       bool              `json:"labor,omitempty"`      // lets locals hire each other
+	Firms       []FirmPolicy      `json:"firms,omitempty"`      // one firm is opened for each
+	Demography  *DemographyPolicy `json:"demography,omitempty"` // lets locals be born, die and move away
+	Ecology     *EcologyPolicy    `json:"ecology,omitempty"`    // goods harvested from populations that regrow by themselves
+	Position    *Position         `json:"position,omitempty"`   // where the city is on the map
+	Gossip      *GossipPolicy     `json:"gossip,omitempty"`     // sends price bulletins to connected cities and listens to theirs
+}
+
+// ScenarioTravelWay declares a one way connection between two cities
+type ScenarioTravelWay struct {
+	From     string   `json:"from"`
+	To       string   `json:"to"`
+	Cost     *float64 `json:"cost,omitempty"`     // defaults to the cost of the distance, or defaultTravelCost if there is none
+	Distance *float64 `json:"distance,omitempty"` // defaults to how far apart the cities are if both have a position, otherwise travel is instant
+}
+
+// The types of events a scenario can schedule, each is turned into an Intervention
+const (
+	EventSetTravelCost        = "setTravelCost"        // uses City, To and Cost
+	EventSetDistance          = "setDistance"          // uses City, To and Distance
+	EventRemoveLocals         = "removeLocals"         // uses City and Count, a Count of 0 removes everyone
+	EventGrantMoney           = "grantMoney"           // uses City and Amount, given to each local
+	EventHelicopterDrop       = "helicopterDrop"       // uses City and Amount, scattered randomly
+	EventSupplyShock          = "supplyShock"          // uses City, Good and Count, a negative Count destroys goods
+	EventPreferenceShift      = "preferenceShift"      // uses City, Good and Factor
+	EventMerchantTax          = "merchantTax"          // uses City, Threshold and Rate
+	EventTaxPolicy            = "taxPolicy"            // uses City and Policy
+	EventToggleSpecialization = "toggleSpecialization" // uses City and Enabled
+	EventBankPolicy           = "bankPolicy"           // uses City and Bank, opens a bank if there isn't one
+	EventMonetaryPolicy       = "monetaryPolicy"       // uses City and Monetary, opens a central bank if there isn't one
+	EventLaborMarket          = "laborMarket"          // uses City and Enabled
+	EventDemographyPolicy     = "demographyPolicy"     // uses City and Demography
+	EventGossipPolicy         = "gossipPolicy"         // uses City and Gossip
+)
+
+// ScenarioEvent is something that happens to a city at a given tick
+type ScenarioEvent struct {
+	Tick       int               `json:"tick"`
+	Type       string            `json:"type"`
+	City       string            `json:"city"`
+	To         string            `json:"to,omitempty"`
+	Cost       float64           `json:"cost,omitempty"`
+	Distance   float64           `json:"distance,omitempty"`
+	Count      int               `json:"count,omitempty"`
+	Amount     float64           `json:"amount,omitempty"`
+	Good       Good              `json:"good,omitempty"`
+	Factor     float64           `json:"factor,omitempty"`
+	Threshold  float64           `json:"threshold,omitempty"`
+	Rate       float64           `json:"rate,omitempty"`
+	Enabled    bool              `json:"enabled,omitempty"`
+	Policy     *TaxPolicy        `json:"policy,omitempty"`
+	Bank       *BankPolicy       `json:"bank,omitempty"`
+	Monetary   *MonetaryPolicy   `json:"monetary,omitempty"`
+	Demography *DemographyPolicy `json:"demography,omitempty"`
+	Gossip     *GossipPolicy     `json:"gossip,omitempty"`
+}
+
+// LoadScenario reads a scenario from a JSON file
+func LoadScenario(path string) (*Scenario, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ParseScenario(file)
+}
+
+// ParseScenario reads a scenario as JSON
+func ParseScenario(reader io.Reader) (*Scenario, error) {
+	scenario := &Scenario{}
+	decoder := json.NewDecoder(reader)
+	decoder.DisallowUnknownFields() // catch typos in scenario files
+	if err := decoder.Decode(scenario); err != nil {
+		return nil, fmt.Errorf("parsing scenario: %w", err)
+	}
+	return scenario, nil
+}
+
+// Build defines the goods of the scenario, creates its cities and travel ways and schedules its events
+func (scenario *Scenario) Build() (*Simulation, error) {
+	definitions, newRecipes := scenario.Goods, scenario.Recipes
+	if definitions == nil {
+		definitions = DefaultGoods()
+	}
+	if newRecipes == nil {
+		newRecipes = DefaultRecipes()
+	}
+	catalog, err := NewCatalog(definitions, newRecipes)
+	if err != nil {
+		return nil, err
+	}
+
+	cities := make([]*City, len(scenario.Cities))
+	for i, spec := range scenario.Cities {
+		if spec.Name == "" {
+			return nil, fmt.Errorf("city %d has no name", i)
+		}
+		col := color.RGBA{spec.Color[0], spec.Color[1], spec.Color[2], spec.Color[3]}
+		cities[i] = catalog.NewCity(spec.Name, col, spec.Size, scenario.Seed+int64(i))
+		if spec.Position != nil {
+			cities[i].SetPosition(*spec.Position)
+		}
+		if scenario.Transit != nil {
+			if err := cities[i].SetTransitPolicy(*scenario.Transit); err != nil {
+				return nil, fmt.Errorf("city %s: %w", spec.Name, err)
+			}
+		}
+		cities[i].Specialize(spec.Specialty)
+		cities[i].SetSpecialized(spec.Specialized)
+		if spec.TaxPolicy != nil {
+			if err := cities[i].SetTaxPolicy(*spec.TaxPolicy); err != nil {
+				return nil, fmt.Errorf("city %s: %w", spec.Name, err)
+			}
+		}
+		marketName := scenario.Market
+		if spec.Market != "" {
+			marketName = spec.Market
+		}
+		market, err := NewMarketMechanism(marketName)
+		if err != nil {
+			return nil, fmt.Errorf("city %s: %w", spec.Name, err)
+		}
+		cities[i].SetMarketMechanism(market)
+		if spec.Bank != nil {
+			if err := cities[i].SetBankPolicy(*spec.Bank); err != nil {
+				return nil, fmt.Errorf("city %s: %w", spec.Name, err)
+			}
+		}
+		if spec.Monetary != nil {
+			if err := cities[i].SetMonetaryPolicy(*spec.Monetary); err != nil {
+				return nil, fmt.Errorf("city %s: %w", spec.Name, err)
+			}
+		}
+		cities[i].SetLaborMarket(spec.Labor)
+		if spec.Demography != nil {
+			if err := cities[i].SetDemographyPolicy(*spec.Demography); err != nil {
+				return nil, fmt.Errorf("city %s: %w", spec.Name, err)
+			}
+		}
+		if spec.Ecology != nil {
+			if err := cities[i].SetEcology(*spec.Ecology); err != nil {
+				return nil, fmt.Errorf("city %s: %w", spec.Name, err)
+			}
+		}
+		if spec.Gossip != nil {
+			if err := cities[i].SetGossipPolicy(*spec.Gossip); err != nil {
+				return nil, fmt.Errorf("city %s: %w", spec.Name, err)
+			}
+		}
+		for _, policy := range spec.Firms {
+			if err := cities[i].AddFirm(policy); err != nil {
+				return nil, fmt.Errorf("city %s: %w", spec.Name, err)
+			}
+		}
+		for _, population := range spec.Population {
+			if err := cities[i].AddPopulation(population); err != nil {
+				return nil, fmt.Errorf("city %s: %w", spec.Name, err)
+			}
+		}
+	}
+	simulation := NewSimulation(cities...)
+
+	for _, spec := range scenario.TravelWays {
+		from, ok := simulation.City(spec.From)
+		if !ok {
+			return nil, fmt.Errorf("travel way from unknown city %s", spec.From)
+		}
+		to, ok := simulation.City(spec.To)
+		if !ok {
+			return nil, fmt.Errorf("travel way to unknown city %s", spec.To)
+		}
+		RegisterTravelWay(from, to)
+		if spec.Cost != nil {
+			from.SetTravelCost(spec.To, *spec.Cost)
+		}
+		if spec.Distance != nil {
+			if err := from.SetDistance(spec.To, *spec.Distance); err != nil {
+				return nil, fmt.Errorf("city %s: %w", spec.From, err)
+			}
+		} else if fromPosition, ok := from.Position(); ok {
+			if toPosition, ok := to.Position(); ok {
+				from.SetDistance(spec.To, fromPosition.Distance(toPosition))
+			}
+		}
+	}
+
+	if err := scenario.ScheduleEvents(simulation); err != nil {
+		return nil, err
+	}
+
+	return simulation, nil
+}
+
+// ScheduleEvents schedules the events of the scenario that haven't happened yet, such as on a simulation loaded from a snapshot
+func (scenario *Scenario) ScheduleEvents(simulation *Simulation) error {
+	for _, event := range scenario.Events {
+		if event.Tick < simulation.Tick() {
+			continue
+		}
+		intervention, err := event.intervention(simulation)
+		if err == nil {
+			err = simulation.InfluenceAt(event.Tick, event.City, intervention)
+		}
+		if err != nil {
+			return fmt.Errorf("event at tick %d: %w", event.Tick, err)
+		}
+	}
+	return nil
+}
+
+func (event ScenarioEvent) intervention(simulation *Simulation) (Intervention, error) {
+	switch event.Type {
+	case EventSetTravelCost:
+		if _, ok := simulation.City(event.To); !ok {
+			return nil, fmt.Errorf("unknown city %s", event.To)
+		}
+		return TravelCostChange{To: event.To, Cost: event.Cost}, nil
+	case EventSetDistance:
+		if event.Distance < 0 {
+			return nil, fmt.Errorf("distance can't be negative")
+		}
+		return DistanceChange{To: event.To, Distance: event.Distance}, nil
+	case EventRemoveLocals:
+		return LocalRemoval{Count: event.Count}, nil
+	case EventGrantMoney:
+		return MoneyInjection{PerLocal: event.Amount}, nil
+	case EventHelicopterDrop:
+		return HelicopterDrop{Total: event.Amount}, nil
+	case EventSupplyShock:
+		return SupplyShock{Good: event.Good, Units: event.Count}, nil
+	case EventPreferenceShift:
+		return PreferenceShift{Good: event.Good, Factor: event.Factor}, nil
+	case EventMerchantTax:
+		return MerchantTaxChange{Threshold: event.Threshold, Rate: event.Rate}, nil
+	case EventTaxPolicy:
+		if event.Policy == nil {
+			return nil, fmt.Errorf("missing policy")
+		}
+		if err := event.Policy.Validate(); err != nil {
+			return nil, err
+		}
+		return TaxPolicyChange{Policy: *event.Policy}, nil
+	case EventToggleSpecialization:
+		return Specialization{Enabled: event.Enabled}, nil
+	case EventDemographyPolicy:
+		if event.Demography == nil {
+			return nil, fmt.Errorf("missing demography policy")
+		}
+		if err := event.Demography.Validate(); err != nil {
+			return nil, err
+		}
+		return DemographyPolicyChange{Policy: *event.Demography}, nil
+	case EventGossipPolicy:
+		if event.Gossip == nil {
+			return nil, fmt.Errorf("missing gossip policy")
+		}
+		if err := event.Gossip.Validate(); err != nil {
+			return nil, err
+		}
+		return GossipPolicyChange{Policy: *event.Gossip}, nil
+	case EventLaborMarket:
+		return LaborMarketToggle{Open: event.Enabled}, nil
+	case EventBankPolicy:
+		if event.Bank == nil {
+			return nil, fmt.Errorf("missing bank policy")
+		}
+		if err := event.Bank.Validate(); err != nil {
+			return nil, err
+		}
+		return BankPolicyChange{Policy: *event.Bank}, nil
+	case EventMonetaryPolicy:
+		if event.Monetary == nil {
+			return nil, fmt.Errorf("missing monetary policy")
+		}
+		if err := event.Monetary.Validate(simulation.Catalog()); err != nil {
+			return nil, err
+		}
+		return MonetaryPolicyChange{Policy: *event.Monetary}, nil
+	}
+	return nil, fmt.Errorf("unknown event type %q", event.Type)
+}
@@ -0,0 +1,164 @@
+package economy
+
+import (
+	"math"
+)
+
+// PriceRange is the spread of expected prices for a good across the locals of a city at one tick
+type PriceRange struct {
+	Min, Max float64
+}
+
+// StopCondition is checked after every tick, returning true ends the run early
+type StopCondition func(*Simulation) bool
+
+// Simulation owns a set of cities and advances them together, recording their history as it goes.
+// It has no knowledge of how (or if) the results get displayed
+type Simulation struct {
+	cities []*City
+	tick   int
+
+	scheduled map[int][]func(*Simulation) // actions to run at the start of a tick
+	observers []func(*Simulation)         // called at the end of every tick
+
+	interventions []AppliedIntervention
+
+	priceHistory map[cityName]map[Good][]PriceRange
+}
+
+// NewSimulation creates a simulation that runs the given cities, they must all trade the goods of the same catalog
+func NewSimulation(cities ...*City) *Simulation {
+	simulation := &Simulation{
+		cities:       cities,
+		scheduled:    make(map[int][]func(*Simulation)),
+		priceHistory: make(map[cityName]map[Good][]PriceRange),
+	}
+
+	for _, city := range cities {
+		simulation.priceHistory[city.name] = make(map[Good][]PriceRange)
+	}
+
+	return simulation
+}
+
+// Catalog returns the goods and recipes every city of the simulation shares
+func (simulation *Simulation) Catalog() *Catalog {
+	if len(simulation.cities) == 0 {
+		return defaultCatalog
+	}
+	return simulation.cities[0].catalog
+}
+
+// Goods returns all the goods that can be traded
+func (simulation *Simulation) Goods() []Good {
+	return simulation.Catalog().Goods()
+}
+
+// Step advances every city by one tick
+func (simulation *Simulation) Step() {
+	for _, action := range simulation.scheduled[simulation.tick] {
+		action(simulation)
+	}
+	delete(simulation.scheduled, simulation.tick)
+
+	for _, city := range simulation.cities {
+		city.Update()
+	}
+	for _, city := range simulation.cities {
+		simulation.record(city)
+	}
+	for _, observer := range simulation.observers {
+		observer(simulation)
+	}
+
+	simulation.tick++
+}
+
+// OnTick registers a function to be called at the end of every tick, such as Recorder.Record.
+// Tick still returns the tick that just ran while observers are called
+func (simulation *Simulation) OnTick(observer func(*Simulation)) {
+	simulation.observers = append(simulation.observers, observer)
+}
+
+// Run advances the simulation by the given number of ticks
+func (simulation *Simulation) Run(ticks int) {
+	for i := 0; i < ticks; i++ {
+		simulation.Step()
+	}
+}
+
+// RunUntil advances the simulation until the stop condition is met or maxTicks have passed, returning the number of ticks run
+func (simulation *Simulation) RunUntil(maxTicks int, stop StopCondition) int {
+	for i := 0; i < maxTicks; i++ {
+		simulation.Step()
+		if stop != nil && stop(simulation) {
+			return i + 1
+		}
+	}
+	return maxTicks
+}
+
+// At schedules an action to run at the start of a tick. Actions scheduled for the same tick run in the order they were added
+func (simulation *Simulation) At(tick int, action func(*Simulation)) {
+	simulation.scheduled[tick] = append(simulation.scheduled[tick], action)
+}
+
+// City finds a city by name
+func (simulation *Simulation) City(name string) (*City, bool) {
+	for _, city := range simulation.cities {
+		if city.name == cityName(name) {
+			return city, true
+		}
+	}
+	return nil, false
+}
+
+// Tick is the number of ticks the simulation has run for
+func (simulation *Simulation) Tick() int {
+	return simulation.tick
+}
+
+// Cities returns the cities being simulated
+func (simulation *Simulation) Cities() []*City {
+	return simulation.cities
+}
+
+// PriceHistory returns the expected price range of a good in a city, one entry per tick
+func (simulation *Simulation) PriceHistory(city *City, good Good) []PriceRange {
+	return simulation.priceHistory[city.name][good]
+}
+
+// LatestPrice returns the most recent expected price range of a good in a city
+func (simulation *Simulation) LatestPrice(city *City, good Good) (PriceRange, bool) {
+	history := simulation.priceHistory[city.name][good]
+	if len(history) == 0 {
+		return PriceRange{}, false
+	}
+	return history[len(history)-1], true
+}
+
+func (simulation *Simulation) record(city *City) {
+	priceRanges := make(map[Good]*PriceRange)
+	for _, good := range city.catalog.goods {
+		priceRanges[good] = &PriceRange{math.MaxFloat64, -math.MaxFloat64}
+	}
+
+	for _, local := range city.locals {
+		for _, good := range city.catalog.goods {
+			market := local.markets[good]
+			if market.expectedMarketPrice < priceRanges[good].Min {
+				priceRanges[good].Min = market.expectedMarketPrice
+			}
+			if market.expectedMarketPrice > priceRanges[good].Max {
+				priceRanges[good].Max = market.expectedMarketPrice
+			}
+		}
+	}
+
+	for good, priceRange := range priceRanges {
+		if len(city.locals) == 0 {
+			priceRange = &PriceRange{} // nobody left to have an opinion
+		}
+		simulation.priceHistory[city.name][good] = append(simulation.priceHistory[city.name][good], *priceRange)
+	}
+}
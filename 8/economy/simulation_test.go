@@ -0,0 +1,31 @@
+package economy
+
+import (
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+func runTestSimulation(seed int64) *Simulation {
+	first := NewCity("First", color.White, 40, seed)
+	second := NewCity("Second", color.Black, 40, seed+1)
+	RegisterTravelWay(first, second)
+	RegisterTravelWay(second, first)
+	simulation := NewSimulation(first, second)
+	simulation.Run(60)
+	return simulation
+}
+
+func TestSameSeedSamePrices(t *testing.T) {
+	first, second := runTestSimulation(1), runTestSimulation(1)
+	if !reflect.DeepEqual(first.priceHistory, second.priceHistory) {
+		t.Error("two runs with the same seed had different prices")
+	}
+}
+
+func TestDifferentSeedDifferentPrices(t *testing.T) {
+	first, second := runTestSimulation(1), runTestSimulation(2)
+	if reflect.DeepEqual(first.priceHistory, second.priceHistory) {
+		t.Error("runs with different seeds had the same prices")
+	}
+}
@@ -0,0 +1,691 @@
+package economy
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"io"
+	"os"
+
+	"github.com/jasonfantl/SimulatedEconomy8/ecology"
+)
+
+// bump whenever the saved format changes. Snapshots are only meant to resume a run with the same build,
+// so there is no migration: files of any other version are refused and the run has to be started again
+const snapshotVersion = 1
+
+// everything needed to resume a simulation. Scheduled actions, observers, ledgers, the intervention log
+// and networked travel ways are not saved, they have to be set up again after loading
+type simulationState struct {
+	Version      int                                `json:"version"`
+	Tick         int                                `json:"tick"`
+	Goods        []GoodDefinition                   `json:"goods"`
+	Recipes      []Recipe                           `json:"recipes"`
+	Cities       []cityState                        `json:"cities"`
+	PriceHistory map[cityName]map[Good][]PriceRange `json:"priceHistory"`
+}
+
+type cityState struct {
+	Name        cityName             `json:"name"`
+	Color       [4]uint8             `json:"color"`
+	RNG         [4]uint64            `json:"rng"` // the state of the city's random number generator
+	Tick        int                  `json:"tick"`
+	NextID      int                  `json:"nextID"`
+	TravelCosts map[cityName]float64 `json:"travelCosts"`
+	Distances   map[cityName]float64 `json:"distances"`
+	Position    *Position            `json:"position,omitempty"`
+	Transit     TransitPolicy        `json:"transit"`
+	Specialty   Good                 `json:"specialty"`
+	Specialized bool                 `json:"specialized"`
+	Market      string               `json:"market"`
+	Orders      *auctionState        `json:"orders,omitempty"` // waiting orders if the market is an auction
+
+	TaxPolicy TaxPolicy         `json:"taxPolicy"`
+	Treasury  float64           `json:"treasury"`
+	Taxes     TaxReport         `json:"taxes"` // collected since the treasury was last spent, migrants pay their fares after that
+	LastTaxes TaxReport         `json:"lastTaxes"`
+	Bank      *bankState        `json:"bank,omitempty"`
+	Monetary  *centralBankState `json:"monetary,omitempty"`
+	Labor     *laborState       `json:"labor,omitempty"` // nil if locals can't hire each other
+
+	Locals    []localState    `json:"locals"`
+	Merchants []merchantState `json:"merchants"`
+	Traders   []traderState   `json:"traders"`
+	Firms     []firmState     `json:"firms"`
+	Unclaimed map[Good]int    `json:"unclaimed,omitempty"` // goods of closed firms waiting for someone to settle
+
+	// what happened during the last tick, for reports
+	Bankruptcies   int                 `json:"bankruptcies"`
+	Trades         map[Good]tradeTally `json:"trades"`
+	LeisureTaken   int                 `json:"leisureTaken"`
+	BulletinsHeard int                 `json:"bulletinsHeard"`
+
+	TravelWaysTo []cityName                   `json:"travelWaysTo"` // outbound travel ways to other cities in the simulation
+	InTransit    map[cityName][]merchantState `json:"inTransit"`    // merchants on their way to this city, by where they came from
+	Travelling   []merchantState              `json:"travelling"`   // merchants who left the travel way but haven't arrived yet
+	Migrating    map[cityName][]localState    `json:"migrating"`    // locals on their way to this city, by where they came from
+	Migrants     []localState                 `json:"migrants"`     // locals who left the travel way but haven't arrived yet
+	Hearing      map[cityName][]priceBulletin `json:"hearing"`      // bulletins on their way to this city, by where they came from
+
+	Demography       *DemographyPolicy `json:"demography,omitempty"`
+	LastDemographics DemographyReport  `json:"lastDemographics"`
+
+	Ecology *ecologyState `json:"ecology,omitempty"` // nil if no goods are harvested from nature
+
+	Gossip    *GossipPolicy   `json:"gossip,omitempty"`
+	Bulletins []priceBulletin `json:"bulletins,omitempty"` // written but not sent yet
+}
+
+type ecologyState struct {
+	Policy      EcologyPolicy      `json:"policy"`
+	Populations map[string]float64 `json:"populations"`
+}
+
+type bankState struct {
+	Policy    BankPolicy          `json:"policy"`
+	Reserves  float64             `json:"reserves"`
+	Deposits  map[AgentID]float64 `json:"deposits"`
+	Deposited float64             `json:"deposited"`
+	Loans     map[AgentID]*loan   `json:"loans"`
+	Defaulted map[AgentID]int     `json:"defaulted"`
+	Report    BankReport          `json:"report"`
+}
+
+type centralBankState struct {
+	Policy        MonetaryPolicy   `json:"policy"`
+	BaseCost      float64          `json:"baseCost"`
+	Prices        map[Good]float64 `json:"prices"`
+	LastIndex     float64          `json:"lastIndex"`
+	TotalCreated  float64          `json:"totalCreated"`
+	Report        MonetaryReport   `json:"report"`
+	NextActionDue int              `json:"nextActionDue"`
+}
+
+type localState struct {
+	ID      AgentID              `json:"id"`
+	Money   float64              `json:"money"`
+	Debt    float64              `json:"debt,omitempty"`
+	Savings float64              `json:"savings,omitempty"`
+	Credit  float64              `json:"credit,omitempty"`
+	Markets map[Good]marketState `json:"markets"`
+
+	ExpectedWage float64 `json:"expectedWage"`
+	Employer     AgentID `json:"employer,omitempty"`
+	Born         int     `json:"born,omitempty"`
+	Parent       AgentID `json:"parent,omitempty"`
+	TransitTicks int     `json:"transitTicks,omitempty"`
+}
+
+type marketState struct {
+	OwnedGoods                  int         `json:"ownedGoods"`
+	BasePersonalValue           float64     `json:"basePersonalValue"`
+	HalfPersonalValueAt         float64     `json:"halfPersonalValueAt"`
+	BeliefVolatility            float64     `json:"beliefVolatility"`
+	GossipFrequency             float64     `json:"gossipFrequency"`
+	TimeSinceLastTransaction    int         `json:"timeSinceLastTransaction"`
+	MaxTimeSinceLastTransaction int         `json:"maxTimeSinceLastTransaction"`
+	ExpectedMarketPrice         float64     `json:"expectedMarketPrice"`
+	Beliefs                     savedBelief `json:"beliefs"`
+}
+
+type traderState struct {
+	ID       AgentID              `json:"id"`
+	Money    float64              `json:"money"`
+	Debt     float64              `json:"debt,omitempty"`
+	Owned    map[Good]int         `json:"owned"`
+	Expected map[Good]float64     `json:"expected"`
+	Beliefs  map[Good]savedBelief `json:"beliefs"`
+	Rule     string               `json:"rule"`
+	Asks     map[Good]float64     `json:"asks"`
+	Bids     map[Good]float64     `json:"bids"`
+	Idle     map[Good]int         `json:"idle"`
+	Strategy savedStrategy        `json:"strategy"`
+}
+
+type firmState struct {
+	ID        AgentID              `json:"id"`
+	Policy    FirmPolicy           `json:"policy"`
+	Recipe    Recipe               `json:"recipe"`
+	Money     float64              `json:"money"`
+	Debt      float64              `json:"debt,omitempty"`
+	Inventory map[Good]int         `json:"inventory"`
+	Costs     map[Good]float64     `json:"costs"`
+	Expected  map[Good]float64     `json:"expected"`
+	Beliefs   map[Good]savedBelief `json:"beliefs"`
+	Rule      string               `json:"rule"`
+	Idle      map[Good]int         `json:"idle"`
+	Insolvent int                  `json:"insolvent"`
+	Report    FirmReport           `json:"report"`
+}
+
+// the JSON encoding of Merchant is meant for travelling, this one also keeps what the merchant is thinking
+type merchantState struct {
+	Merchant         *Merchant `json:"merchant"`
+	City             cityName  `json:"city"`
+	BestSellLocation cityName  `json:"bestSellLocation"`
+}
+
+// Save writes the full state of the simulation so it can be resumed with LoadSimulation
+func (simulation *Simulation) Save(writer io.Writer) error {
+	catalog := simulation.Catalog()
+	state := simulationState{
+		Version:      snapshotVersion,
+		Tick:         simulation.tick,
+		Goods:        catalog.Definitions(),
+		Recipes:      catalog.recipes,
+		PriceHistory: simulation.priceHistory,
+	}
+
+	for _, city := range simulation.cities {
+		state.Cities = append(state.Cities, simulation.saveCity(city))
+	}
+
+	encoder := json.NewEncoder(writer)
+	return encoder.Encode(state)
+}
+
+// SaveFile writes the full state of the simulation to a file
+func (simulation *Simulation) SaveFile(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := simulation.Save(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func (simulation *Simulation) saveCity(city *City) cityState {
+	r, g, b, a := city.color.RGBA()
+	state := cityState{
+		Name:        city.name,
+		Color:       [4]uint8{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), uint8(a >> 8)},
+		RNG:         city.source.state,
+		Tick:        city.tick,
+		NextID:      city.nextID,
+		TravelCosts: city.travelCosts,
+		Distances:   city.distances,
+		Position:    city.position,
+		Transit:     city.transit,
+		Specialty:   city.specialty,
+		Specialized: city.specialized,
+		Market:      city.market.Name(),
+		InTransit:   make(map[cityName][]merchantState),
+		Migrating:   make(map[cityName][]localState),
+		Hearing:     make(map[cityName][]priceBulletin),
+
+		TaxPolicy: city.taxPolicy,
+		Treasury:  city.treasury,
+		Unclaimed: city.unclaimed,
+		Taxes:     city.taxReport,
+		LastTaxes: city.lastTaxReport,
+
+		Bankruptcies:   city.lastBankruptcies,
+		Trades:         make(map[Good]tradeTally),
+		LeisureTaken:   city.lastLeisureTaken,
+		BulletinsHeard: city.lastBulletinsHeard,
+
+		Demography:       city.demography,
+		LastDemographics: city.lastDemographics,
+
+		Gossip:    city.gossip,
+		Bulletins: city.bulletins,
+	}
+
+	if auction, ok := city.market.(*AuctionMarket); ok {
+		state.Orders = auction.save()
+	}
+	for good, tally := range city.trades {
+		state.Trades[good] = *tally
+	}
+
+	if bank := city.bank; bank != nil {
+		state.Bank = &bankState{
+			Policy:    bank.policy,
+			Reserves:  bank.reserves,
+			Deposits:  bank.deposits,
+			Deposited: bank.deposited,
+			Loans:     bank.loans,
+			Defaulted: bank.defaulted,
+			Report:    bank.lastReport,
+		}
+	}
+
+	if centralBank := city.centralBank; centralBank != nil {
+		state.Monetary = &centralBankState{
+			Policy:        centralBank.policy,
+			BaseCost:      centralBank.baseCost,
+			Prices:        centralBank.prices,
+			LastIndex:     centralBank.lastIndex,
+			TotalCreated:  centralBank.totalCreated,
+			Report:        centralBank.report,
+			NextActionDue: centralBank.nextActionDue,
+		}
+	}
+
+	if city.labor != nil {
+		state.Labor = city.labor.save()
+	}
+
+	if city.ecosystem != nil {
+		state.Ecology = &ecologyState{Policy: *city.ecology, Populations: city.ecosystem.Populations()}
+	}
+
+	for _, local := range city.locals {
+		state.Locals = append(state.Locals, saveLocal(local))
+	}
+
+	for _, trader := range city.traders {
+		traderState := traderState{
+			ID:       trader.ID,
+			Money:    trader.money,
+			Debt:     trader.debt,
+			Owned:    trader.owned,
+			Expected: trader.expected,
+			Beliefs:  make(map[Good]savedBelief),
+			Rule:     trader.rule,
+			Asks:     trader.asks,
+			Bids:     trader.bids,
+			Idle:     trader.idle,
+			Strategy: savedStrategy{trader.tactics},
+		}
+		for good, rule := range trader.beliefs {
+			traderState.Beliefs[good] = savedBelief{rule}
+		}
+		state.Traders = append(state.Traders, traderState)
+	}
+
+	for _, firm := range city.firms {
+		firmState := firmState{
+			ID:        firm.ID,
+			Policy:    firm.policy,
+			Recipe:    firm.recipe,
+			Money:     firm.money,
+			Debt:      firm.debt,
+			Inventory: firm.inventory,
+			Costs:     firm.costs,
+			Expected:  firm.expected,
+			Beliefs:   make(map[Good]savedBelief),
+			Rule:      firm.rule,
+			Idle:      firm.idle,
+			Insolvent: firm.insolvent,
+			Report:    firm.lastReport,
+		}
+		for good, rule := range firm.beliefs {
+			firmState.Beliefs[good] = savedBelief{rule}
+		}
+		state.Firms = append(state.Firms, firmState)
+	}
+
+	for _, merchant := range city.merchants {
+		state.Merchants = append(state.Merchants, saveMerchant(merchant))
+	}
+	for _, merchant := range city.travelling {
+		state.Travelling = append(state.Travelling, saveMerchant(merchant))
+	}
+	for _, local := range city.migrants {
+		state.Migrants = append(state.Migrants, saveLocal(local))
+	}
+
+	city.outboundTravelWays.Range(func(to cityName, _ chan *Merchant) bool {
+		if _, ok := simulation.City(string(to)); ok {
+			state.TravelWaysTo = append(state.TravelWaysTo, to)
+		}
+		return true
+	})
+
+	// look at who is in transit by emptying the channel and putting everyone back in the same order
+	city.inboundTravelWays.Range(func(from cityName, channel chan *Merchant) bool {
+		if _, ok := simulation.City(string(from)); !ok {
+			return true
+		}
+		travelling := make([]*Merchant, 0)
+		for exists, merchant := city.receiveImmigrant(channel); exists; exists, merchant = city.receiveImmigrant(channel) {
+			travelling = append(travelling, merchant)
+		}
+		for _, merchant := range travelling {
+			state.InTransit[from] = append(state.InTransit[from], saveMerchant(merchant))
+			channel <- merchant
+		}
+		return true
+	})
+	city.inboundMigrations.Range(func(from cityName, channel chan *Local) bool {
+		travelling := make([]*Local, 0)
+		for exists, local := city.receiveMigrant(channel); exists; exists, local = city.receiveMigrant(channel) {
+			travelling = append(travelling, local)
+		}
+		for _, local := range travelling {
+			state.Migrating[from] = append(state.Migrating[from], saveLocal(local))
+			channel <- local
+		}
+		return true
+	})
+	city.inboundGossip.Range(func(from cityName, channel chan priceBulletin) bool {
+		if _, ok := simulation.City(string(from)); !ok {
+			return true
+		}
+		hearing := make([]priceBulletin, 0)
+		for len(channel) > 0 {
+			hearing = append(hearing, <-channel)
+		}
+		for _, bulletin := range hearing {
+			state.Hearing[from] = append(state.Hearing[from], bulletin)
+			channel <- bulletin
+		}
+		return true
+	})
+
+	return state
+}
+
+func saveLocal(local *Local) localState {
+	state := localState{
+		ID:      local.ID,
+		Money:   local.money,
+		Debt:    local.debt,
+		Savings: local.savings,
+		Credit:  local.credit,
+		Markets: make(map[Good]marketState),
+
+		ExpectedWage: local.expectedWage,
+		Employer:     local.employer,
+		Born:         local.born,
+		Parent:       local.parent,
+		TransitTicks: local.transitTicks,
+	}
+	for good, market := range local.markets {
+		state.Markets[good] = marketState{
+			OwnedGoods:                  market.ownedGoods,
+			BasePersonalValue:           market.basePersonalValue,
+			HalfPersonalValueAt:         market.halfPersonalValueAt,
+			BeliefVolatility:            market.beliefVolatility,
+			GossipFrequency:             market.gossipFrequency,
+			TimeSinceLastTransaction:    market.timeSinceLastTransaction,
+			MaxTimeSinceLastTransaction: market.maxTimeSinceLastTransaction,
+			ExpectedMarketPrice:         market.expectedMarketPrice,
+			Beliefs:                     savedBelief{market.beliefs},
+		}
+	}
+	return state
+}
+
+func (state localState) restore() *Local {
+	local := &Local{
+		ID:      state.ID,
+		money:   state.Money,
+		debt:    state.Debt,
+		savings: state.Savings,
+		credit:  state.Credit,
+		markets: make(map[Good]*Market),
+
+		expectedWage: state.ExpectedWage,
+		employer:     state.Employer,
+		born:         state.Born,
+		parent:       state.Parent,
+		transitTicks: state.TransitTicks,
+	}
+	for good, market := range state.Markets {
+		local.markets[good] = &Market{
+			ownedGoods:                  market.OwnedGoods,
+			basePersonalValue:           market.BasePersonalValue,
+			halfPersonalValueAt:         market.HalfPersonalValueAt,
+			beliefVolatility:            market.BeliefVolatility,
+			gossipFrequency:             market.GossipFrequency,
+			timeSinceLastTransaction:    market.TimeSinceLastTransaction,
+			maxTimeSinceLastTransaction: market.MaxTimeSinceLastTransaction,
+			expectedMarketPrice:         market.ExpectedMarketPrice,
+			beliefs:                     market.Beliefs.Rule,
+		}
+	}
+	return local
+}
+
+func saveMerchant(merchant *Merchant) merchantState {
+	return merchantState{
+		Merchant:         merchant,
+		City:             merchant.city,
+		BestSellLocation: merchant.bestSellLocation,
+	}
+}
+
+func (state merchantState) restore() *Merchant {
+	merchant := state.Merchant
+	merchant.city = state.City
+	merchant.bestSellLocation = state.BestSellLocation
+	return merchant
+}
+
+// LoadSimulation recreates a simulation saved with Save. It will continue exactly as the saved simulation would have
+func LoadSimulation(reader io.Reader) (*Simulation, error) {
+	state := simulationState{}
+	if err := json.NewDecoder(reader).Decode(&state); err != nil {
+		return nil, fmt.Errorf("reading snapshot: %w", err)
+	}
+	if state.Version != snapshotVersion {
+		return nil, fmt.Errorf("snapshot is version %d but this build only loads version %d, older snapshots can't be converted so rerun the scenario to make a new one", state.Version, snapshotVersion)
+	}
+
+	catalog, err := NewCatalog(state.Goods, state.Recipes)
+	if err != nil {
+		return nil, err
+	}
+
+	cities := make([]*City, len(state.Cities))
+	for i, cityState := range state.Cities {
+		city, err := cityState.restore(catalog)
+		if err != nil {
+			return nil, err
+		}
+		cities[i] = city
+	}
+
+	simulation := NewSimulation(cities...)
+	simulation.tick = state.Tick
+	for name, history := range state.PriceHistory {
+		simulation.priceHistory[name] = history
+	}
+
+	// connect the cities back up, then fill the travel ways with whoever was travelling
+	for i, cityState := range state.Cities {
+		for _, to := range cityState.TravelWaysTo {
+			toCity, ok := simulation.City(string(to))
+			if !ok {
+				return nil, fmt.Errorf("travel way to unknown city %s", to)
+			}
+			RegisterTravelWay(cities[i], toCity)
+		}
+	}
+	for i, cityState := range state.Cities {
+		for from, travelling := range cityState.InTransit {
+			channel, ok := cities[i].inboundTravelWays.Load(from)
+			if !ok {
+				return nil, fmt.Errorf("merchants in transit from %s to %s without a travel way", from, cityState.Name)
+			}
+			for _, merchant := range travelling {
+				channel <- merchant.restore()
+			}
+		}
+		for from, travelling := range cityState.Migrating {
+			channel, ok := cities[i].inboundMigrations.Load(from)
+			if !ok {
+				return nil, fmt.Errorf("locals migrating from %s to %s without a travel way", from, cityState.Name)
+			}
+			for _, local := range travelling {
+				channel <- local.restore()
+			}
+		}
+		for from, hearing := range cityState.Hearing {
+			channel, ok := cities[i].inboundGossip.Load(from)
+			if !ok {
+				return nil, fmt.Errorf("bulletins on their way from %s to %s without a travel way", from, cityState.Name)
+			}
+			for _, bulletin := range hearing {
+				channel <- bulletin
+			}
+		}
+	}
+
+	return simulation, nil
+}
+
+// LoadSimulationFile recreates a simulation saved with SaveFile
+func LoadSimulationFile(path string) (*Simulation, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return LoadSimulation(file)
+}
+
+func (state cityState) restore(catalog *Catalog) (*City, error) {
+	col := color.RGBA{state.Color[0], state.Color[1], state.Color[2], state.Color[3]}
+	city := newEmptyCity(string(state.Name), col, catalog, restoreSavableSource(state.RNG))
+	city.tick = state.Tick
+	city.nextID = state.NextID
+	city.specialty = state.Specialty
+	city.specialized = state.Specialized
+	market, err := NewMarketMechanism(state.Market)
+	if err != nil {
+		return nil, fmt.Errorf("city %s: %w", state.Name, err)
+	}
+	city.market = market
+	city.taxPolicy = state.TaxPolicy
+	city.treasury = state.Treasury
+	for good, units := range state.Unclaimed {
+		city.unclaimed[good] = units
+	}
+	city.taxReport = state.Taxes
+	city.lastTaxReport = state.LastTaxes
+	for to, cost := range state.TravelCosts {
+		city.travelCosts[to] = cost
+	}
+	for to, distance := range state.Distances {
+		city.distances[to] = distance
+	}
+	city.position = state.Position
+	city.transit = state.Transit
+	if state.Bank != nil {
+		city.bank = newBank(state.Bank.Policy)
+		city.bank.reserves = state.Bank.Reserves
+		city.bank.deposited = state.Bank.Deposited
+		city.bank.lastReport = state.Bank.Report
+		for id, deposit := range state.Bank.Deposits {
+			city.bank.deposits[id] = deposit
+		}
+		for id, loan := range state.Bank.Loans {
+			city.bank.loans[id] = loan
+		}
+		for id, tick := range state.Bank.Defaulted {
+			city.bank.defaulted[id] = tick
+		}
+	}
+	if monetary := state.Monetary; monetary != nil {
+		city.centralBank = &CentralBank{
+			policy:        monetary.Policy,
+			baseCost:      monetary.BaseCost,
+			prices:        monetary.Prices,
+			lastIndex:     monetary.LastIndex,
+			totalCreated:  monetary.TotalCreated,
+			report:        monetary.Report,
+			nextActionDue: monetary.NextActionDue,
+		}
+	}
+
+	for _, localState := range state.Locals {
+		city.locals = append(city.locals, localState.restore())
+	}
+
+	for _, traderState := range state.Traders {
+		trader := &Trader{
+			ID:       traderState.ID,
+			catalog:  catalog,
+			money:    traderState.Money,
+			debt:     traderState.Debt,
+			owned:    traderState.Owned,
+			expected: traderState.Expected,
+			beliefs:  make(map[Good]BeliefRule),
+			rule:     traderState.Rule,
+			asks:     traderState.Asks,
+			bids:     traderState.Bids,
+			idle:     traderState.Idle,
+			tactics:  traderState.Strategy.Strategy,
+		}
+		for good, saved := range traderState.Beliefs {
+			trader.beliefs[good] = saved.Rule
+		}
+		city.traders = append(city.traders, trader)
+	}
+
+	for _, firmState := range state.Firms {
+		firm := &Firm{
+			ID:         firmState.ID,
+			catalog:    catalog,
+			policy:     firmState.Policy,
+			recipe:     firmState.Recipe,
+			money:      firmState.Money,
+			debt:       firmState.Debt,
+			inventory:  firmState.Inventory,
+			costs:      firmState.Costs,
+			expected:   firmState.Expected,
+			beliefs:    make(map[Good]BeliefRule),
+			rule:       firmState.Rule,
+			idle:       firmState.Idle,
+			insolvent:  firmState.Insolvent,
+			lastReport: firmState.Report,
+		}
+		for good, saved := range firmState.Beliefs {
+			firm.beliefs[good] = saved.Rule
+		}
+		city.firms = append(city.firms, firm)
+	}
+	city.lastBankruptcies = state.Bankruptcies
+	for good, tally := range state.Trades {
+		tally := tally
+		city.trades[good] = &tally
+	}
+	city.lastLeisureTaken = state.LeisureTaken
+	city.lastBulletinsHeard = state.BulletinsHeard
+	city.demography = state.Demography
+	city.lastDemographics = state.LastDemographics
+	city.gossip = state.Gossip
+	city.bulletins = state.Bulletins
+
+	for _, merchantState := range state.Merchants {
+		city.merchants = append(city.merchants, merchantState.restore())
+	}
+	for _, merchantState := range state.Travelling {
+		city.travelling = append(city.travelling, merchantState.restore())
+	}
+	for _, localState := range state.Migrants {
+		city.migrants = append(city.migrants, localState.restore())
+	}
+
+	if auction, ok := city.market.(*AuctionMarket); ok && state.Orders != nil {
+		agents := make(map[AgentID]EconomicAgent)
+		for _, agent := range city.allEconomicAgents() {
+			agents[agent.id()] = agent
+		}
+		auction.restore(state.Orders, agents)
+	}
+
+	if state.Labor != nil {
+		city.labor = newLaborMarket()
+		city.labor.restore(state.Labor, city.locals)
+	}
+
+	if state.Ecology != nil {
+		ecosystem, err := ecology.Restore(state.Ecology.Policy.Ecosystem, state.Ecology.Populations)
+		if err != nil {
+			return nil, fmt.Errorf("city %s: %w", state.Name, err)
+		}
+		policy := state.Ecology.Policy
+		city.ecology = &policy
+		city.ecosystem = ecosystem
+	}
+
+	return city, nil
+}
@@ -0,0 +1,100 @@
+package economy
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// scenarios covering the optional parts of a city, each is run briefly
+var testScenarios = []string{"twoCities", "thread", "taxes", "auction", "strategies", "credit", "inflation", "labor", "firms", "population", "ecology", "map", "chain", "gossip"}
+
+func buildScenario(t *testing.T, name string) (*Scenario, *Simulation) {
+	t.Helper()
+	scenario, err := LoadScenario("../scenarios/" + name + ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	simulation, err := scenario.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return scenario, simulation
+}
+
+func save(t *testing.T, simulation *Simulation) []byte {
+	t.Helper()
+	buffer := &bytes.Buffer{}
+	if err := simulation.Save(buffer); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func TestLoadedSimulationCarriesOn(t *testing.T) {
+	const savedAt, ranFor = 30, 25
+	for _, name := range testScenarios {
+		t.Run(name, func(t *testing.T) {
+			scenario, straight := buildScenario(t, name)
+			straight.Run(savedAt + ranFor)
+
+			_, saved := buildScenario(t, name)
+			saved.Run(savedAt)
+			loaded, err := LoadSimulation(bytes.NewReader(save(t, saved)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := scenario.ScheduleEvents(loaded); err != nil {
+				t.Fatal(err)
+			}
+			if loaded.Tick() != savedAt {
+				t.Fatalf("loaded at tick %d, saved at %d", loaded.Tick(), savedAt)
+			}
+			loaded.Run(ranFor)
+
+			if !bytes.Equal(save(t, straight), save(t, loaded)) {
+				t.Error("the loaded simulation didn't carry on like the one that was never saved")
+			}
+		})
+	}
+}
+
+func TestLoadedSimulationRecordsTheSame(t *testing.T) {
+	const savedAt = 30
+	for _, name := range testScenarios {
+		t.Run(name, func(t *testing.T) {
+			_, saved := buildScenario(t, name)
+			saved.Run(savedAt)
+			loaded, err := LoadSimulation(bytes.NewReader(save(t, saved)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			before, after := NewRecorder(), NewRecorder()
+			before.Record(saved)
+			after.Record(loaded)
+			for i, snapshot := range before.Snapshots() {
+				if fields := differentFields(snapshot, after.Snapshots()[i]); len(fields) > 0 {
+					t.Errorf("%s recorded different %v after loading", snapshot.City, fields)
+				}
+			}
+		})
+	}
+}
+
+func differentFields(a, b Snapshot) []string {
+	fields := make([]string, 0)
+	aValue, bValue := reflect.ValueOf(a), reflect.ValueOf(b)
+	for i := 0; i < aValue.NumField(); i++ {
+		if !reflect.DeepEqual(aValue.Field(i).Interface(), bValue.Field(i).Interface()) {
+			fields = append(fields, aValue.Type().Field(i).Name)
+		}
+	}
+	return fields
+}
+
+func TestLoadRefusesOtherVersions(t *testing.T) {
+	if _, err := LoadSimulation(bytes.NewReader([]byte(`{"version": 0}`))); err == nil {
+		t.Error("loaded a snapshot from another version")
+	}
+}
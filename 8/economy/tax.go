@@ -0,0 +1,207 @@
+package economy
+
+import (
+	"fmt"
+	"sort"
+)
+
+// TaxBracket is a marginal rate paid on the part of an amount above a threshold
+type TaxBracket struct {
+	Above float64 `json:"above"`
+	Rate  float64 `json:"rate"`
+}
+
+// TaxBrackets are progressive, each rate only applies to the part of the amount between its threshold and the next
+type TaxBrackets []TaxBracket
+
+// Tax is how much is owed on an amount
+func (brackets TaxBrackets) Tax(amount float64) float64 {
+	sorted := append(TaxBrackets{}, brackets...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Above < sorted[j].Above })
+
+	tax := 0.0
+	for i, bracket := range sorted {
+		if amount <= bracket.Above {
+			break
+		}
+		top := amount
+		if i+1 < len(sorted) && sorted[i+1].Above < amount {
+			top = sorted[i+1].Above
+		}
+		tax += (top - bracket.Above) * bracket.Rate
+	}
+	return tax
+}
+
+// Validate checks every rate is between 0 and 1 and no threshold is negative
+func (brackets TaxBrackets) Validate() error {
+	for _, bracket := range brackets {
+		if bracket.Above < 0 {
+			return fmt.Errorf("bracket threshold %v can't be negative", bracket.Above)
+		}
+		if bracket.Rate < 0 || bracket.Rate > 1 {
+			return fmt.Errorf("bracket above %v has rate %v, must be between 0 and 1", bracket.Above, bracket.Rate)
+		}
+	}
+	return nil
+}
+
+// The ways a city can spend its tax revenue
+const (
+	RedistributeEqually     = "equal"       // split evenly between all locals
+	RedistributeMeansTested = "meansTested" // split evenly between locals with less money than MeansTestBelow
+	RedistributeToTreasury  = "treasury"    // kept by the city
+)
+
+// TaxPolicy decides what a city taxes and what it does with the money
+type TaxPolicy struct {
+	IncomeTax float64          `json:"incomeTax,omitempty"` // fraction of the price the seller pays on every trade
+	SalesTax  map[Good]float64 `json:"salesTax,omitempty"`  // fraction of the price the buyer pays on top, per good
+
+	WealthTax      TaxBrackets `json:"wealthTax,omitempty"`      // on the money of everyone in the city: locals, merchants, traders and firms
+	WealthTaxEvery int         `json:"wealthTaxEvery,omitempty"` // how many ticks between wealth taxes, 0 never taxes wealth
+
+	EntryTollFlat     float64     `json:"entryTollFlat,omitempty"`     // every arriving merchant pays this
+	EntryTollBrackets TaxBrackets `json:"entryTollBrackets,omitempty"` // and this on the money they arrive with
+
+	Redistribution string  `json:"redistribution,omitempty"` // defaults to RedistributeEqually
+	MeansTestBelow float64 `json:"meansTestBelow,omitempty"`
+}
+
+// DefaultTaxPolicy taxes rich merchants as they arrive and splits it between the locals
+func DefaultTaxPolicy() TaxPolicy {
+	return TaxPolicy{
+		EntryTollBrackets: TaxBrackets{{Above: 1000, Rate: 0.1}},
+		Redistribution:    RedistributeEqually,
+	}
+}
+
+// Validate checks the policy makes sense
+func (policy TaxPolicy) Validate() error {
+	switch policy.Redistribution {
+	case "", RedistributeEqually, RedistributeMeansTested, RedistributeToTreasury:
+	default:
+		return fmt.Errorf("unknown redistribution %q", policy.Redistribution)
+	}
+	if policy.IncomeTax < 0 || policy.IncomeTax > 1 {
+		return fmt.Errorf("income tax must be between 0 and 1")
+	}
+	for good, rate := range policy.SalesTax {
+		if rate < 0 {
+			return fmt.Errorf("sales tax on %s can't be negative", good)
+		}
+	}
+	if err := policy.WealthTax.Validate(); err != nil {
+		return fmt.Errorf("wealth tax: %w", err)
+	}
+	if policy.WealthTaxEvery < 0 {
+		return fmt.Errorf("wealth tax every can't be negative")
+	}
+	if err := policy.EntryTollBrackets.Validate(); err != nil {
+		return fmt.Errorf("entry toll: %w", err)
+	}
+	if policy.EntryTollFlat < 0 {
+		return fmt.Errorf("flat entry toll can't be negative")
+	}
+	return nil
+}
+
+// TaxReport is what a city collected and paid out during a tick
+type TaxReport struct {
+	Income, Sales, Wealth, Tolls float64 // revenue from each tax
+	Fares                        float64 // paid by merchants leaving along travel ways with a distance
+	Transfers                    float64 // paid out to locals
+	Treasury                     float64 // held by the city at the end of the tick
+}
+
+// Revenue is the total collected
+func (report TaxReport) Revenue() float64 {
+	return report.Income + report.Sales + report.Wealth + report.Tolls + report.Fares
+}
+
+// SetTaxPolicy replaces the city's tax policy
+func (city *City) SetTaxPolicy(policy TaxPolicy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	city.taxPolicy = policy
+	return nil
+}
+
+// TaxPolicy returns the city's tax policy
+func (city *City) TaxPolicy() TaxPolicy {
+	return city.taxPolicy
+}
+
+// TaxReport returns what the city collected and paid out during the last tick
+func (city *City) TaxReport() TaxReport {
+	return city.lastTaxReport
+}
+
+// taxes on a trade, the buyer pays on top of the price and the seller pays out of it
+func (city *City) taxTrade(good Good, buyer, seller EconomicAgent, price float64) {
+	if rate := city.taxPolicy.SalesTax[good]; rate > 0 {
+		city.taxReport.Sales += city.collect(buyer, price*rate)
+	}
+	if city.taxPolicy.IncomeTax > 0 {
+		city.taxReport.Income += city.collect(seller, price*city.taxPolicy.IncomeTax)
+	}
+}
+
+// toll on a merchant as they arrive
+func (city *City) taxArrival(merchant *Merchant) {
+	toll := city.taxPolicy.EntryTollFlat + city.taxPolicy.EntryTollBrackets.Tax(merchant.Money)
+	city.taxReport.Tolls += city.collect(merchant, toll)
+}
+
+// tax the money of every agent in the city if it's time to
+func (city *City) taxWealth() {
+	if city.taxPolicy.WealthTaxEvery <= 0 || city.tick%city.taxPolicy.WealthTaxEvery != 0 {
+		return
+	}
+	for _, agent := range city.allEconomicAgents() {
+		city.taxReport.Wealth += city.collect(agent, city.taxPolicy.WealthTax.Tax(agent.balance()))
+	}
+}
+
+// takes up to amount from the agent (nobody is taxed into debt), returning how much was taken
+func (city *City) collect(agent EconomicAgent, amount float64) float64 {
+	if amount > agent.balance() {
+		amount = agent.balance()
+	}
+	if amount <= 0 {
+		return 0
+	}
+	agent.addMoney(-amount)
+	city.treasury += amount
+	return amount
+}
+
+// spend the treasury as the policy says, then start a new report
+func (city *City) redistribute() {
+	recipients := city.locals
+	switch city.taxPolicy.Redistribution {
+	case RedistributeToTreasury:
+		recipients = nil
+	case RedistributeMeansTested:
+		recipients = make([]*Local, 0)
+		for _, local := range city.locals {
+			if local.money < city.taxPolicy.MeansTestBelow {
+				recipients = append(recipients, local)
+			}
+		}
+	}
+
+	if len(recipients) > 0 && city.treasury > 0 {
+		share := city.treasury / float64(len(recipients))
+		for _, local := range recipients {
+			local.money += share
+		}
+		city.taxReport.Transfers = city.treasury
+		city.treasury = 0
+	}
+
+	city.taxReport.Treasury = city.treasury
+	city.lastTaxReport = city.taxReport
+	city.taxReport = TaxReport{}
+}
@@ -0,0 +1,49 @@
+package economy
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTaxBrackets(t *testing.T) {
+	// given out of order on purpose, the brackets are sorted before use
+	brackets := TaxBrackets{{Above: 100, Rate: 0.5}, {Above: 0, Rate: 0.1}, {Above: 50, Rate: 0.2}}
+	cases := []struct {
+		amount, tax float64
+	}{
+		{-10, 0},
+		{0, 0},
+		{30, 3},
+		{50, 5},
+		{80, 5 + 6},
+		{100, 5 + 10},
+		{150, 5 + 10 + 25},
+	}
+	for _, c := range cases {
+		if tax := brackets.Tax(c.amount); math.Abs(tax-c.tax) > 1e-9 {
+			t.Errorf("tax on %v is %v, expected %v", c.amount, tax, c.tax)
+		}
+	}
+
+	if tax := (TaxBrackets{}).Tax(100); tax != 0 {
+		t.Errorf("no brackets should mean no tax, got %v", tax)
+	}
+	if tax := (TaxBrackets{{Above: 20, Rate: 1}}).Tax(50); tax != 30 {
+		t.Errorf("a rate of 1 should take everything above the threshold, got %v", tax)
+	}
+}
+
+func TestTaxBracketsValidate(t *testing.T) {
+	if err := (TaxBrackets{{Above: 0, Rate: 0.1}, {Above: 10, Rate: 1}}).Validate(); err != nil {
+		t.Error(err)
+	}
+	for _, brackets := range []TaxBrackets{
+		{{Above: -1, Rate: 0.1}},
+		{{Above: 0, Rate: -0.1}},
+		{{Above: 0, Rate: 1.5}},
+	} {
+		if err := brackets.Validate(); err == nil {
+			t.Errorf("%v should be invalid", brackets)
+		}
+	}
+}
@@ -0,0 +1,380 @@
+package economy
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// TradingStrategy decides what a trader is willing to pay and ask. Each trader gets their own strategy, so strategies can keep state
+type TradingStrategy interface {
+	Name() string
+	// Quote returns the most the trader would pay for one more unit of a good and the least they would sell one for, 0 if they won't
+	Quote(trader *Trader, good Good, rng *rand.Rand) (bid, ask float64)
+	// Traded is called after the trader bought or sold one unit
+	Traded(trader *Trader, good Good, buying bool, price float64)
+	// Idle is called when the trader has gone a while without trading a good
+	Idle(trader *Trader, good Good)
+}
+
+// a trader won't hold more than this many of any good
+const traderCapacity = 10
+
+// how many updates a trader waits for a trade before their strategy is told they are idle
+const traderPatience = 10
+
+// Trader only buys and sells, they don't produce or consume anything. How they trade is up to their strategy
+type Trader struct {
+	ID       AgentID
+	catalog  *Catalog
+	money    float64
+	debt     float64 // owed to the city's bank
+	owned    map[Good]int
+	expected map[Good]float64    // what the trader believes each good sells for
+	beliefs  map[Good]BeliefRule // how those beliefs change
+	rule     string              // the name of the belief rule
+	asks     map[Good]float64    // what the trader is currently asking, 0 when not selling
+	bids     map[Good]float64    // what the trader is currently bidding, 0 when not buying
+	idle     map[Good]int        // updates since each good was last traded
+	tactics  TradingStrategy
+}
+
+// NewTrader creates a trader with some money and no goods. They start off believing what the locals of the city believe
+func NewTrader(city *City, strategy TradingStrategy, beliefs string) (*Trader, error) {
+	trader := &Trader{
+		ID:       city.newID(TraderAgent),
+		catalog:  city.catalog,
+		money:    1000,
+		owned:    make(map[Good]int),
+		expected: make(map[Good]float64),
+		beliefs:  make(map[Good]BeliefRule),
+		asks:     make(map[Good]float64),
+		bids:     make(map[Good]float64),
+		idle:     make(map[Good]int),
+		rule:     beliefs,
+		tactics:  strategy,
+	}
+
+	for _, good := range city.catalog.goods {
+		rule, err := NewBeliefRule(beliefs)
+		if err != nil {
+			return nil, err
+		}
+		trader.beliefs[good] = rule
+		trader.expected[good] = city.meanExpectedPrice(good)
+	}
+
+	return trader, nil
+}
+
+func (trader *Trader) update(city *City) {
+	// usually people don't try to buy or sell things
+	if city.rng.Float64() > 0.1 {
+		return
+	}
+
+	nearbyAgents := city.allEconomicAgents()
+	for _, good := range city.catalog.goods {
+		// hear what someone else thinks
+		if len(nearbyAgents) > 0 {
+			if otherAgent := nearbyAgents[city.rng.Intn(len(nearbyAgents))]; otherAgent != trader {
+				if heard, ok := otherAgent.gossip(good); ok {
+					trader.expected[good] = trader.beliefs[good].Heard(trader.expected[good], trader.volatility(good), heard)
+				}
+			}
+		}
+
+		bid, ask := trader.tactics.Quote(trader, good, city.rng)
+		trader.asks[good] = ask
+		trader.bids[good] = bid
+		city.market.offer(city, good, trader)
+
+		if spendingPower := city.spendingPower(trader); bid > 0 && spendingPower > 0 && trader.owned[good] < traderCapacity {
+			city.market.buy(city, good, trader, math.Min(bid, spendingPower), nearbyAgents)
+		}
+
+		trader.idle[good]++
+		if trader.idle[good] > traderPatience {
+			trader.idle[good] = 0
+			trader.tactics.Idle(trader, good)
+		}
+	}
+}
+
+func (trader *Trader) volatility(good Good) float64 {
+	return trader.catalog.meanVolatility(good)
+}
+
+func (trader *Trader) isSelling(good Good) (bool, float64) {
+	if trader.owned[good] <= 0 || trader.asks[good] <= 0 {
+		return false, 0
+	}
+	return true, trader.asks[good]
+}
+
+func (trader *Trader) isBuying(_ *City, good Good) (bool, float64) {
+	if trader.owned[good] >= traderCapacity || trader.bids[good] <= 0 {
+		return false, 0
+	}
+	return true, trader.bids[good]
+}
+
+func (trader *Trader) transact(good Good, buying bool, price float64) {
+	trader.idle[good] = 0
+	if buying {
+		trader.money -= price
+		trader.owned[good]++
+	} else {
+		trader.money += price
+		trader.owned[good]--
+		trader.asks[good] = 0 // has to quote again before selling another
+	}
+	trader.expected[good] = trader.beliefs[good].Traded(trader.expected[good], trader.volatility(good), buying, price)
+	trader.tactics.Traded(trader, good, buying, price)
+}
+
+func (trader *Trader) gossip(good Good) (float64, bool) {
+	expected, ok := trader.expected[good]
+	return expected, ok
+}
+
+func (trader *Trader) id() AgentID {
+	return trader.ID
+}
+
+func (trader *Trader) kind() AgentKind {
+	return TraderAgent
+}
+
+func (trader *Trader) balance() float64 {
+	return trader.money
+}
+
+func (trader *Trader) addMoney(amount float64) {
+	trader.money += amount
+}
+
+func (trader *Trader) setDebt(_ cityName, debt float64) {
+	trader.debt = debt
+}
+
+// Debt returns how much the trader owes the bank
+func (trader *Trader) Debt() float64 {
+	return trader.debt
+}
+
+func (trader *Trader) strategy() string {
+	return trader.tactics.Name() + "/" + trader.rule
+}
+
+func (trader *Trader) holding(good Good) int {
+	return trader.owned[good]
+}
+
+// Money returns how much money the trader has
+func (trader *Trader) Money() float64 {
+	return trader.money
+}
+
+// Owned returns how many of a good the trader holds
+func (trader *Trader) Owned(good Good) int {
+	return trader.owned[good]
+}
+
+// ExpectedPrice returns what the trader believes a good sells for
+func (trader *Trader) ExpectedPrice(good Good) float64 {
+	return trader.expected[good]
+}
+
+// Strategy returns the trader's strategy
+func (trader *Trader) Strategy() TradingStrategy {
+	return trader.tactics
+}
+
+// the built in trading strategies
+const (
+	ZeroIntelligenceName = "zeroIntelligence"
+	AdaptiveTraderName   = "adaptive"
+	MarketMakerName      = "marketMaker"
+)
+
+var tradingStrategies = map[string]func() TradingStrategy{}
+
+func init() {
+	RegisterTradingStrategy(ZeroIntelligenceName, func() TradingStrategy { return &ZeroIntelligence{Paid: map[Good]float64{}} }, SmoothedBeliefsName)
+	RegisterTradingStrategy(AdaptiveTraderName, func() TradingStrategy { return &AdaptiveTrader{Margins: map[Good]float64{}} }, SmoothedBeliefsName)
+	RegisterTradingStrategy(MarketMakerName, func() TradingStrategy { return &MarketMaker{Spread: 0.1, Target: traderCapacity / 2} }, KalmanBeliefsName)
+}
+
+// RegisterTradingStrategy makes a trading strategy available by name, and registers an agent kind of the same name
+// for traders using it, who use defaultBeliefs unless told otherwise. create must return a new strategy every time
+func RegisterTradingStrategy(name string, create func() TradingStrategy, defaultBeliefs string) {
+	tradingStrategies[name] = create
+	RegisterAgentKind(name, func(city *City, beliefs string) error {
+		if beliefs == "" {
+			beliefs = defaultBeliefs
+		}
+		trader, err := NewTrader(city, create(), beliefs)
+		if err != nil {
+			return err
+		}
+		city.traders = append(city.traders, trader)
+		return nil
+	})
+}
+
+// NewTradingStrategy creates a trading strategy from its name
+func NewTradingStrategy(name string) (TradingStrategy, error) {
+	create, ok := tradingStrategies[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown trading strategy %q", name)
+	}
+	return create(), nil
+}
+
+// ZeroIntelligence bids and asks random prices, only constrained to never sell for less than it paid (Gode and Sunder's ZI-C traders)
+type ZeroIntelligence struct {
+	Paid map[Good]float64 `json:"paid"` // average price paid for the units held
+}
+
+// Name implements TradingStrategy
+func (strategy *ZeroIntelligence) Name() string {
+	return ZeroIntelligenceName
+}
+
+// Quote implements TradingStrategy, prices are drawn from up to twice the expected price
+func (strategy *ZeroIntelligence) Quote(trader *Trader, good Good, rng *rand.Rand) (float64, float64) {
+	ceiling := 2 * math.Max(trader.ExpectedPrice(good), 0)
+	bid := rng.Float64() * ceiling
+	ask := 0.0
+	if trader.Owned(good) > 0 {
+		ask = strategy.Paid[good] + rng.Float64()*math.Max(ceiling-strategy.Paid[good], 0)
+	}
+	return bid, ask
+}
+
+// Traded implements TradingStrategy
+func (strategy *ZeroIntelligence) Traded(trader *Trader, good Good, buying bool, price float64) {
+	if buying {
+		owned := float64(trader.Owned(good))
+		strategy.Paid[good] = (strategy.Paid[good]*(owned-1) + price) / owned
+	} else if trader.Owned(good) == 0 {
+		strategy.Paid[good] = 0
+	}
+}
+
+// Idle implements TradingStrategy
+func (strategy *ZeroIntelligence) Idle(trader *Trader, good Good) {}
+
+// AdaptiveTrader quotes around the expected price with a profit margin it learns, like Cliff's ZIP traders.
+// Trading makes it greedier, going without makes it less so
+type AdaptiveTrader struct {
+	Margins map[Good]float64 `json:"margins"`
+}
+
+const (
+	adaptiveStartingMargin = 0.05
+	adaptiveMinMargin      = 0.001
+	adaptiveMaxMargin      = 0.5
+)
+
+func (strategy *AdaptiveTrader) margin(good Good) float64 {
+	if _, ok := strategy.Margins[good]; !ok {
+		strategy.Margins[good] = adaptiveStartingMargin
+	}
+	return strategy.Margins[good]
+}
+
+// Name implements TradingStrategy
+func (strategy *AdaptiveTrader) Name() string {
+	return AdaptiveTraderName
+}
+
+// Quote implements TradingStrategy
+func (strategy *AdaptiveTrader) Quote(trader *Trader, good Good, rng *rand.Rand) (float64, float64) {
+	expected := trader.ExpectedPrice(good)
+	margin := strategy.margin(good)
+	ask := 0.0
+	if trader.Owned(good) > 0 {
+		ask = expected * (1 + margin)
+	}
+	return expected * (1 - margin), ask
+}
+
+// Traded implements TradingStrategy
+func (strategy *AdaptiveTrader) Traded(trader *Trader, good Good, buying bool, price float64) {
+	strategy.Margins[good] = math.Min(strategy.margin(good)*1.1, adaptiveMaxMargin)
+}
+
+// Idle implements TradingStrategy
+func (strategy *AdaptiveTrader) Idle(trader *Trader, good Good) {
+	strategy.Margins[good] = math.Max(strategy.margin(good)*0.9, adaptiveMinMargin)
+}
+
+// MarketMaker always quotes both sides of the market around the expected price, shifting its quotes to get back to a target inventory
+type MarketMaker struct {
+	Spread float64 `json:"spread"` // between the bid and ask, as a fraction of the expected price
+	Target int     `json:"target"` // how many of each good it would like to hold
+}
+
+// Name implements TradingStrategy
+func (strategy *MarketMaker) Name() string {
+	return MarketMakerName
+}
+
+// Quote implements TradingStrategy
+func (strategy *MarketMaker) Quote(trader *Trader, good Good, rng *rand.Rand) (float64, float64) {
+	// holding too much lowers both prices to sell it off, holding too little raises them to buy more
+	skew := 0.0
+	if strategy.Target > 0 {
+		skew = float64(trader.Owned(good)-strategy.Target) / float64(strategy.Target) * strategy.Spread / 2
+	}
+	middle := trader.ExpectedPrice(good) * (1 - skew)
+	ask := 0.0
+	if trader.Owned(good) > 0 {
+		ask = middle * (1 + strategy.Spread/2)
+	}
+	return middle * (1 - strategy.Spread/2), ask
+}
+
+// Traded implements TradingStrategy
+func (strategy *MarketMaker) Traded(trader *Trader, good Good, buying bool, price float64) {}
+
+// Idle implements TradingStrategy
+func (strategy *MarketMaker) Idle(trader *Trader, good Good) {}
+
+// savedStrategy lets a trading strategy be saved and restored along with its state
+type savedStrategy struct {
+	Strategy TradingStrategy
+}
+
+func (saved savedStrategy) MarshalJSON() ([]byte, error) {
+	state, err := json.Marshal(saved.Strategy)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(struct {
+		Name  string          `json:"name"`
+		State json.RawMessage `json:"state"`
+	}{saved.Strategy.Name(), state})
+}
+
+func (saved *savedStrategy) UnmarshalJSON(data []byte) error {
+	named := struct {
+		Name  string          `json:"name"`
+		State json.RawMessage `json:"state"`
+	}{}
+	if err := json.Unmarshal(data, &named); err != nil {
+		return err
+	}
+	strategy, err := NewTradingStrategy(named.Name)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(named.State, strategy); err != nil {
+		return fmt.Errorf("trading strategy %s: %w", named.Name, err)
+	}
+	saved.Strategy = strategy
+	return nil
+}
@@ -6,31 +6,34 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"net"
 	"os"
 	"runtime"
+	"sort"
 	"strconv"
-	"strings"
 	"sync"
 	"syscall"
+	"time"
 )
 
-type travelWays struct {
-	channels map[cityName]chan *Merchant
+// travelWays are the channels between a city and the cities it is connected to, carrying merchants or migrating locals
+type travelWays[T any] struct {
+	channels map[cityName]chan T
 	mutex    sync.Mutex
 }
 
-func (travelWays *travelWays) Store(city cityName, channel chan *Merchant) {
+func (travelWays *travelWays[T]) Store(city cityName, channel chan T) {
 	travelWays.mutex.Lock()
 	defer travelWays.mutex.Unlock()
 	if travelWays.channels == nil {
-		travelWays.channels = make(map[cityName]chan *Merchant)
+		travelWays.channels = make(map[cityName]chan T)
 	}
 
 	travelWays.channels[city] = channel
 }
 
-func (travelWays *travelWays) Load(city cityName) (chan *Merchant, bool) {
+func (travelWays *travelWays[T]) Load(city cityName) (chan T, bool) {
 	travelWays.mutex.Lock()
 	defer travelWays.mutex.Unlock()
 	if travelWays.channels == nil {
@@ -40,7 +43,7 @@ func (travelWays *travelWays) Load(city cityName) (chan *Merchant, bool) {
 	return ch, ok
 }
 
-func (travelWays *travelWays) Delete(city cityName) {
+func (travelWays *travelWays[T]) Delete(city cityName) {
 	travelWays.mutex.Lock()
 	defer travelWays.mutex.Unlock()
 	if travelWays.channels == nil {
@@ -49,33 +52,87 @@ func (travelWays *travelWays) Delete(city cityName) {
 	delete(travelWays.channels, city)
 }
 
-func (travelWays *travelWays) Range(f func(cityName, chan *Merchant) bool) {
+// Range visits the travelWays in order of city name, so iteration is always the same
+func (travelWays *travelWays[T]) Range(f func(cityName, chan T) bool) {
 	travelWays.mutex.Lock()
 	defer travelWays.mutex.Unlock()
-	if travelWays.channels == nil {
-		return
-	}
-	for k, v := range travelWays.channels {
-		if !f(k, v) {
+	for _, k := range travelWays.sortedNames() {
+		if !f(k, travelWays.channels[k]) {
 			break
 		}
 	}
 }
 
+// Random picks a travelWay using rng and returns where it goes, returns false if there are none
+func (travelWays *travelWays[T]) Random(rng *rand.Rand) (cityName, chan T, bool) {
+	travelWays.mutex.Lock()
+	defer travelWays.mutex.Unlock()
+	names := travelWays.sortedNames()
+	if len(names) == 0 {
+		return "", nil, false
+	}
+	name := names[rng.Intn(len(names))]
+	return name, travelWays.channels[name], true
+}
+
+// Names returns the connected cities in order of name
+func (travelWays *travelWays[T]) Names() []cityName {
+	travelWays.mutex.Lock()
+	defer travelWays.mutex.Unlock()
+	return travelWays.sortedNames()
+}
+
+// must hold the mutex
+func (travelWays *travelWays[T]) sortedNames() []cityName {
+	names := make([]cityName, 0, len(travelWays.channels))
+	for k := range travelWays.channels {
+		names = append(names, k)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
+
 // RegisterTravelWay connects cities using channels
 func RegisterTravelWay(fromCity *City, toCity *City) {
 	channel := make(chan *Merchant, 100)
 	toCity.inboundTravelWays.Store(fromCity.name, channel)
 	fromCity.outboundTravelWays.Store(toCity.name, channel)
+
+	migrants := make(chan *Local, 100)
+	toCity.inboundMigrations.Store(fromCity.name, migrants)
+	fromCity.outboundMigrations.Store(toCity.name, migrants)
+
+	bulletins := make(chan priceBulletin, 100)
+	toCity.inboundGossip.Store(fromCity.name, bulletins)
+	fromCity.outboundGossip.Store(toCity.name, bulletins)
 }
 
 type networkedTravelWays struct {
 	city   *City
 	server net.Listener
+
+	// merchants are handed over exactly once, see handoff.go
+	mutex         sync.Mutex
+	connected     map[cityName]*peer
+	pending       map[cityName][]transfer // sent but not yet acknowledged or refused
+	nextTransfer  int
+	received      map[string]bool // transfers already answered, true if let in. Resent merchants get the same answer
+	receivedOrder []string
+	returned      []*Merchant            // refused by the city they were sent to
+	abandoned     []chan *Merchant       // outbound travel ways that closed, merchants still on them never left
+	stranded      []*Merchant            // received but still on the travel way when it closed
+	disconnects   map[cityName]int       // how many times each city hung up, so a city that came back isn't given up on
+	onTheWay      map[chan *Merchant]int // merchants on each connection's outbound travel way who haven't been sent yet
+
+	// see lifecycle.go
+	closed      bool
+	quit        chan struct{}     // closed when the city leaves the network
+	connections map[net.Conn]bool // every open connection, including those still saying hello
+	handlers    sync.WaitGroup    // one for each connection being handled
 }
 
 // setupNetworkedTravelWay will listen for incoming connections and add them to the cities travelWays. It can also connect to another networkTravelWay
-func setupNetworkedTravelWay(portNumber int, city *City) *networkedTravelWays {
+func setupNetworkedTravelWay(portNumber int, city *City) (*networkedTravelWays, error) {
 
 	// start a TCP server to listen for requests on
 	listener, err := net.Listen("tcp", "localhost:"+strconv.Itoa(portNumber))
@@ -83,150 +140,256 @@ func setupNetworkedTravelWay(portNumber int, city *City) *networkedTravelWays {
 		portNumber++
 		listener, err = net.Listen("tcp", "localhost:"+strconv.Itoa(portNumber))
 	}
-	if err != nil && !isErrorAddressAlreadyInUse(err) {
-		fmt.Println(err)
-		return nil
+	if err != nil {
+		return nil, err
 	}
 
-	travelWays := &networkedTravelWays{
-		city:   city,
-		server: listener,
-	}
+	travelWays := newNetworkedTravelWays(city, listener)
 
 	// listen for incoming connection requests in the background
 	fmt.Printf("%s is listening for tcp connection requests at %s\n", city.name, listener.Addr().String())
 	go func() {
 		for {
 			connection, err := listener.Accept() // blocking call here
+			if errors.Is(err, net.ErrClosed) {
+				return // the city left the network
+			}
 			if err != nil {
 				fmt.Println(err)
 				continue
 			}
 
 			// each connection is handled by its own process
-			go travelWays.handleConnection(connection)
+			travelWays.handle(connection)
 		}
 	}()
 
-	return travelWays
+	return travelWays, nil
+}
+
+func newNetworkedTravelWays(city *City, server net.Listener) *networkedTravelWays {
+	return &networkedTravelWays{
+		city:        city,
+		server:      server,
+		connected:   make(map[cityName]*peer),
+		pending:     make(map[cityName][]transfer),
+		received:    make(map[string]bool),
+		disconnects: make(map[cityName]int),
+		onTheWay:    make(map[chan *Merchant]int),
+		quit:        make(chan struct{}),
+		connections: make(map[net.Conn]bool),
+	}
 }
 
 func (travelWays *networkedTravelWays) requestConnection(address string) {
 	fmt.Printf("Requesting connection: %s...\n", address)
 
-	connection, err := net.Dial("tcp", address)
+	connection, err := net.DialTimeout("tcp", address, handshakeTimeout)
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
 
+	travelWays.handle(connection)
+}
+
+// handle the connection in the background, unless the city has left the network
+func (travelWays *networkedTravelWays) handle(connection net.Conn) {
+	travelWays.mutex.Lock()
+	defer travelWays.mutex.Unlock()
+	if travelWays.closed {
+		connection.Close()
+		return
+	}
+	travelWays.connections[connection] = true
+	travelWays.handlers.Add(1)
 	go travelWays.handleConnection(connection)
 }
 
 // blocking, must be handled as a new routine
 func (travelWays *networkedTravelWays) handleConnection(connection net.Conn) {
-	done := make(chan bool)
-	outboundChannel := make(chan *Merchant, 100)
-	inboundChannel := make(chan *Merchant, 100)
-
-	// send our city's name. Blocking, so run in separate routine
-	go func() {
-		_, err := connection.Write([]byte(travelWays.city.name + "\n"))
-		if err != nil {
-			fmt.Println(err)
-			done <- true
-		}
+	defer func() {
+		connection.Close()
+		travelWays.mutex.Lock()
+		delete(travelWays.connections, connection)
+		travelWays.mutex.Unlock()
+		travelWays.handlers.Done()
 	}()
 
-	// get the city's name
-	reader := bufio.NewReader(connection)
-	line, err := reader.ReadString('\n')
+	peer, err := handshake(connection, travelWays.city)
 	if err != nil {
-		fmt.Println(err)
+		fmt.Printf("refused connection from %s: %v\n", connection.RemoteAddr(), err)
 		return
 	}
-	line = strings.TrimSpace(line)
-
-	remoteCityName := cityName(line)
+	remoteCityName := peer.remote.City
 
 	// make sure we aren't already connected to the city
 	if _, alreadyExist := travelWays.city.outboundTravelWays.Load(remoteCityName); alreadyExist {
-		fmt.Printf("error: travelWay from %s to %s already exists in outbound travelWays\n", remoteCityName, travelWays.city.name)
+		peer.refuse(fmt.Sprintf("travelWay from %s to %s already exists in outbound travelWays", travelWays.city.name, remoteCityName))
 		return
 	}
 	if _, alreadyExist := travelWays.city.inboundTravelWays.Load(remoteCityName); alreadyExist {
-		fmt.Printf("error: travelWay from %s to %s already exists in inbound travelWays\n", remoteCityName, travelWays.city.name)
+		peer.refuse(fmt.Sprintf("travelWay from %s to %s already exists in inbound travelWays", remoteCityName, travelWays.city.name))
+		return
+	}
+
+	outboundChannel := make(chan *Merchant, 100)
+	travelWays.mutex.Lock()
+	if travelWays.closed {
+		travelWays.mutex.Unlock()
+		peer.refuse(fmt.Sprintf("%s is leaving the network", travelWays.city.name))
 		return
 	}
+	travelWays.connected[remoteCityName] = peer
+	travelWays.onTheWay[outboundChannel] = 0
+	travelWays.mutex.Unlock()
+
+	done := make(chan bool, 2)
+	closing := make(chan struct{})
+	inboundChannel := make(chan *Merchant, 100)
+	outboundBulletins := make(chan priceBulletin, 100)
+	inboundBulletins := make(chan priceBulletin, 100)
 
 	// add travelWay to city
 	travelWays.city.inboundTravelWays.Store(remoteCityName, inboundChannel)
 	travelWays.city.outboundTravelWays.Store(remoteCityName, outboundChannel)
+	travelWays.city.inboundGossip.Store(remoteCityName, inboundBulletins)
+	travelWays.city.outboundGossip.Store(remoteCityName, outboundBulletins)
 
 	fmt.Printf("Successfully added city %s as a network connection, sending and receiving merchants...\n", remoteCityName)
 
-	go travelWays.handleIncomingMessages(connection, inboundChannel, done)
-	go travelWays.handleOutgoingMessages(connection, outboundChannel, done)
+	go travelWays.handleIncomingMessages(peer, inboundChannel, inboundBulletins, done)
+	go travelWays.handleOutgoingMessages(peer, outboundChannel, outboundBulletins, closing, done)
+	if peer.capabilities[capabilityPing] {
+		go heartbeat(peer, closing)
+	}
 
-	// wait for connection to close
+	// wait for connection to close, then for the other side of it to stop
+	<-done
+	close(closing)
+	connection.Close()
 	<-done
 	travelWays.city.outboundTravelWays.Delete(remoteCityName)
 	travelWays.city.inboundTravelWays.Delete(remoteCityName)
+	travelWays.city.outboundGossip.Delete(remoteCityName)
+	travelWays.city.inboundGossip.Delete(remoteCityName)
+
+	travelWays.strand(inboundChannel)
+	travelWays.disconnected(remoteCityName, outboundChannel)
 
 	fmt.Printf("Connection to %s closed\n", remoteCityName)
-	connection.Close()
 }
 
 // blocking, must be handled as a new routine
-func (travelWays *networkedTravelWays) handleIncomingMessages(connection net.Conn, channel chan *Merchant, done chan bool) {
+func (travelWays *networkedTravelWays) handleIncomingMessages(peer *peer, channel chan *Merchant, bulletins chan priceBulletin, done chan bool) {
 	defer func() {
 		done <- true
 	}()
 
 	// pass merchants from connection to channel
-	reader := bufio.NewReader(connection)
 	for {
-		line, err := reader.ReadString('\n')
+		// a peer that answers pings is never quiet for long, if it is it must be gone
+		if peer.capabilities[capabilityPing] {
+			peer.connection.SetReadDeadline(time.Now().Add(peerTimeout))
+		}
+		message, err := peer.receive()
 		if err != nil {
-			if err != io.EOF && err != syscall.EPIPE {
+			if errors.Is(err, errPeerClosed) {
+				fmt.Printf("%s: %v\n", peer.remote.City, err)
+			} else if errors.Is(err, os.ErrDeadlineExceeded) {
+				fmt.Printf("%s stopped answering, hanging up\n", peer.remote.City)
+				peer.refuse(fmt.Sprintf("heard nothing for %v", peerTimeout))
+			} else if err != io.EOF && !errors.Is(err, syscall.EPIPE) && !errors.Is(err, net.ErrClosed) {
 				fmt.Println(err)
+				peer.refuse(err.Error())
 			}
 			break
 		}
 
-		// Deserialize the merchant object
-		merchant := &Merchant{}
-		err = json.Unmarshal([]byte(line), merchant)
-		if err != nil {
-			fmt.Println(err)
-			continue
+		switch message.Type {
+		case messageMerchant:
+			// Deserialize the merchant object
+			sent := transfer{}
+			if err := json.Unmarshal(message.Body, &sent); err != nil || sent.Merchant == nil {
+				fmt.Println("bad merchant:", err)
+				continue
+			}
+			// a merchant we already let in was resent because our acknowledgement got lost, only acknowledge them again
+			letIn, welcome := travelWays.accept(sent.ID)
+			if !welcome {
+				peer.send(messageRefused, ackMessage{ID: sent.ID})
+				continue
+			}
+			if letIn {
+				select {
+				case channel <- sent.Merchant:
+				case <-travelWays.quit: // the city isn't taking anyone off the travel way anymore
+					travelWays.mutex.Lock()
+					travelWays.stranded = append(travelWays.stranded, sent.Merchant)
+					travelWays.mutex.Unlock()
+				}
+			}
+			peer.send(messageAck, ackMessage{ID: sent.ID})
+		case messageAck, messageRefused:
+			ack := ackMessage{}
+			if err := json.Unmarshal(message.Body, &ack); err != nil {
+				fmt.Println(err)
+				continue
+			}
+			if message.Type == messageAck {
+				travelWays.acknowledge(peer.remote.City, ack.ID)
+			} else {
+				travelWays.refused(peer.remote.City, ack.ID)
+			}
+		case messagePing:
+			peer.send(messagePong, struct{}{})
+		case messagePong:
+		case messageGossip:
+			bulletin := priceBulletin{}
+			if err := json.Unmarshal(message.Body, &bulletin); err != nil {
+				fmt.Println(err)
+				continue
+			}
+			select {
+			case bulletins <- bulletin:
+			default: // the city isn't keeping up, news is cheap to lose
+			}
+		default:
+			fmt.Printf("%s sent an unknown %s message\n", peer.remote.City, message.Type)
 		}
-
-		channel <- merchant
 	}
 }
 
 // blocking, must be handled as a new routine
-func (travelWays *networkedTravelWays) handleOutgoingMessages(connection net.Conn, channel chan *Merchant, done chan bool) {
+func (travelWays *networkedTravelWays) handleOutgoingMessages(peer *peer, channel chan *Merchant, bulletins chan priceBulletin, closing chan struct{}, done chan bool) {
 	defer func() {
 		done <- true
 	}()
 
-	// pass merchants from channel into connection
-	writer := bufio.NewWriter(connection)
+	// merchants that never got acknowledged on an earlier connection try again
+	for _, sent := range travelWays.pendingTo(peer.remote.City) {
+		if err := peer.send(messageMerchant, sent); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
 
+	// pass merchants from channel into connection, they stay pending until acknowledged. Bulletins are only sent to peers that want them
 	for {
-		merchant := <-channel
-
-		// Serialize the merchant object
-		merchantBytes, err := json.Marshal(merchant)
-		if err != nil {
-			fmt.Println(err)
-			continue
+		var err error
+		select {
+		case merchant := <-channel:
+			sent := travelWays.pickUp(peer.remote.City, channel, merchant)
+			err = peer.send(messageMerchant, sent)
+		case bulletin := <-bulletins:
+			if peer.capabilities[capabilityGossip] {
+				err = peer.send(messageGossip, bulletin)
+			}
+		case <-closing:
+			return
 		}
 
-		err = writeAndFlush(writer, merchantBytes)
-		if err == io.EOF || err == syscall.EPIPE {
+		if err == io.EOF || errors.Is(err, syscall.EPIPE) || errors.Is(err, net.ErrClosed) {
 			// connection broken, nothing unusual about that
 			break
 		}
@@ -1,4 +1,5 @@
-package economy
+// Package graphing draws the state of a simulation to an ebiten screen
+package graphing
 
 import (
 	"fmt"
@@ -8,69 +9,33 @@ import (
 
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/jasonfantl/SimulatedEconomy8/analytics"
+	"github.com/jasonfantl/SimulatedEconomy8/economy"
 )
 
-type dataPoint struct {
-	min, max float64
-	color    color.Color
-}
-
-var previousDataPoints map[Good]map[cityName][]*dataPoint = make(map[Good]map[cityName][]*dataPoint)
-
-func updateGraph(city *City) {
-
-	datapoints := make(map[Good]*dataPoint)
-	for _, good := range goods {
-		datapoints[good] = &dataPoint{math.MaxFloat64, -math.MaxFloat64, city.color}
-	}
-
-	for local := range city.locals {
-		for good, market := range local.markets {
-			if good == LEISURE {
-				continue
-			}
-			if market.expectedMarketPrice < datapoints[good].min {
-				datapoints[good].min = market.expectedMarketPrice
-			}
-			if market.expectedMarketPrice > datapoints[good].max {
-				datapoints[good].max = market.expectedMarketPrice
-			}
-		}
-	}
-
-	for good, datapoint := range datapoints {
-		if _, ok := previousDataPoints[good]; !ok {
-			previousDataPoints[good] = make(map[cityName][]*dataPoint)
-		}
-		if _, ok := previousDataPoints[good][city.name]; !ok {
-			previousDataPoints[good][city.name] = make([]*dataPoint, 0)
-		}
-		previousDataPoints[good][city.name] = append(previousDataPoints[good][city.name], datapoint)
-	}
-}
-
-// GraphExpectedValues will graph the expected values of a specific city
-func GraphExpectedValues(screen *ebiten.Image, title string, good Good, drawXOff, drawYOff, drawXZoom, drawYZoom float64, xRange, jumpXAxis, jumpYAxis int) {
+// GraphExpectedValues will graph the expected values of a good in every city of the simulation
+func GraphExpectedValues(screen *ebiten.Image, simulation *economy.Simulation, title string, good economy.Good, drawXOff, drawYOff, drawXZoom, drawYZoom float64, xRange, jumpXAxis, jumpYAxis int) {
 
 	minX, maxX := math.MaxInt, 0
 	maxY := 0.0
 
-	for location := range previousDataPoints[good] {
+	for _, city := range simulation.Cities() {
+		history := simulation.PriceHistory(city, good)
 		// add new data points (and get max/min X and Y values)
-		v := len(previousDataPoints[good][location])
+		v := len(history)
 		if v > maxX {
 			maxX = v
 		}
-		if len(previousDataPoints[good][location])-xRange < minX {
-			minX = len(previousDataPoints[good][location]) - xRange
+		if len(history)-xRange < minX {
+			minX = len(history) - xRange
 		}
 		if minX < 0 {
 			minX = 0
 		}
 
-		for i, v := range previousDataPoints[good][location] {
-			if i > len(previousDataPoints[good][location])-xRange && v.max > maxY {
-				maxY = v.max
+		for i, v := range history {
+			if i > len(history)-xRange && v.Max > maxY {
+				maxY = v.Max
 			}
 		}
 	}
@@ -98,29 +63,41 @@ func GraphExpectedValues(screen *ebiten.Image, title string, good Good, drawXOff
 		ebitenutil.DebugPrintAt(screen, fmt.Sprintf("%d", i), x-20, y-5)
 	}
 
+	// mark when interventions happened so their effect can be seen
+	for _, applied := range simulation.Interventions() {
+		if applied.Tick < minX || applied.Tick > maxX {
+			continue
+		}
+		if city, ok := simulation.City(applied.City); ok {
+			x := drawXOff + drawXZoom*float64(applied.Tick-minX)
+			ebitenutil.DrawLine(screen, x, drawYOff, x, drawYOff-drawYZoom*maxY, city.Color())
+		}
+	}
+
 	// graph data
-	for location := range previousDataPoints[good] {
+	for _, city := range simulation.Cities() {
+		history := simulation.PriceHistory(city, good)
 		i := 0
-		if len(previousDataPoints[good][location]) > xRange {
-			i = len(previousDataPoints[good][location]) - xRange
+		if len(history) > xRange {
+			i = len(history) - xRange
 		}
-		for ; i < len(previousDataPoints[good][location]); i++ {
+		for ; i < len(history); i++ {
 			// expected values
-			datapoint := previousDataPoints[good][location][i]
-			x, y := drawXOff+drawXZoom*float64(i-minX), drawYOff-drawYZoom*(datapoint.min+datapoint.max)/2.0
+			priceRange := history[i]
+			x, y := drawXOff+drawXZoom*float64(i-minX), drawYOff-drawYZoom*(priceRange.Min+priceRange.Max)/2.0
 
 			w := 0.4
-			h := datapoint.max - datapoint.min
+			h := priceRange.Max - priceRange.Min
 			if h < 3 {
 				h = 3
 			}
-			ebitenutil.DrawRect(screen, x-w/2.0, y-h/2.0, w, h, datapoint.color)
+			ebitenutil.DrawRect(screen, x-w/2.0, y-h/2.0, w, h, city.Color())
 		}
 	}
 }
 
 // GraphGoodsVMoney will graph a point for each resident, comparing their goods to money
-func GraphGoodsVMoney(screen *ebiten.Image, city City, title string, good Good, drawXOff, drawYOff, drawXZoom, drawYZoom float64, jumpXAxis, jumpYAxis int) {
+func GraphGoodsVMoney(screen *ebiten.Image, city *economy.City, title string, good economy.Good, drawXOff, drawYOff, drawXZoom, drawYZoom float64, jumpXAxis, jumpYAxis int) {
 
 	type dataPoint struct {
 		x, y float64
@@ -131,13 +108,13 @@ func GraphGoodsVMoney(screen *ebiten.Image, city City, title string, good Good,
 	minY, maxY := 0.0, 0.0
 
 	points := make([]dataPoint, 0)
-	for local := range city.locals {
-		x := local.money
-		y := float64(local.markets[good].ownedGoods)
+	for _, local := range city.Locals() {
+		x := local.Money()
+		y := float64(local.Owned(good))
 		points = append(points, dataPoint{
 			x:   x,
 			y:   y,
-			col: city.color,
+			col: city.Color(),
 		})
 		if x < minX {
 			minX = x
@@ -153,13 +130,13 @@ func GraphGoodsVMoney(screen *ebiten.Image, city City, title string, good Good,
 		}
 	}
 
-	for merchant := range city.merchants {
+	for _, merchant := range city.Merchants() {
 		if good != merchant.BuysSells {
 			continue
 		}
 		x := merchant.Money
 		y := float64(merchant.Owned)
-		r, g, b, _ := city.color.RGBA()
+		r, g, b, _ := city.Color().RGBA()
 
 		points = append(points, dataPoint{
 			x:   x,
@@ -207,7 +184,7 @@ func GraphGoodsVMoney(screen *ebiten.Image, city City, title string, good Good,
 }
 
 // GraphLeisureVWealth will graph a point for each resident, comparing their value of leisure to their wealth
-func GraphLeisureVWealth(screen *ebiten.Image, city City, title string, drawXOff, drawYOff, drawXZoom, drawYZoom float64, jumpXAxis, jumpYAxis int) {
+func GraphLeisureVWealth(screen *ebiten.Image, city *economy.City, title string, drawXOff, drawYOff, drawXZoom, drawYZoom float64, jumpXAxis, jumpYAxis int) {
 
 	type dataPoint struct {
 		x, y float64
@@ -218,17 +195,17 @@ func GraphLeisureVWealth(screen *ebiten.Image, city City, title string, drawXOff
 	minY, maxY := 0.0, 0.0
 
 	points := make([]dataPoint, 0)
-	for local := range city.locals {
-		x := local.money
-		// for _, market := range local.markets {
-		// 	x += market.expectedMarketPrice * float64(market.ownedGoods)
+	for _, local := range city.Locals() {
+		x := local.Money()
+		// for _, good := range city.Goods() {
+		// 	x += local.ExpectedPrice(good) * float64(local.Owned(good))
 		// }
-		y := float64(local.markets[LEISURE].basePersonalValue)
+		y := float64(local.BasePersonalValue(economy.LEISURE))
 
 		points = append(points, dataPoint{
 			x:   x,
 			y:   y,
-			col: city.color,
+			col: city.Color(),
 		})
 		if x < minX {
 			minX = x
@@ -271,20 +248,24 @@ func GraphLeisureVWealth(screen *ebiten.Image, city City, title string, drawXOff
 }
 
 // GraphMerchantType will graph the number of all the different merchant types
-func GraphMerchantType(screen *ebiten.Image, cities []*City, title string, drawXOff, drawYOff, drawXZoom, drawYZoom float64) {
+func GraphMerchantType(screen *ebiten.Image, cities []*economy.City, title string, drawXOff, drawYOff, drawXZoom, drawYZoom float64) {
 
-	points := make(map[Good]map[cityName]int)
-	totals := make(map[Good]int)
+	points := make(map[economy.Good]map[string]int)
+	totals := make(map[economy.Good]int)
 
+	goods := economy.DefaultCatalog().Goods()
+	if len(cities) > 0 {
+		goods = cities[0].Goods()
+	}
 	for _, good := range goods {
-		points[good] = make(map[cityName]int)
+		points[good] = make(map[string]int)
 		for _, city := range cities {
-			points[good][city.name] = 0
+			points[good][city.Name()] = 0
 		}
 	}
 	for _, city := range cities {
-		for merchant := range city.merchants {
-			points[merchant.BuysSells][city.name]++
+		for _, merchant := range city.Merchants() {
+			points[merchant.BuysSells][city.Name()]++
 			totals[merchant.BuysSells]++
 		}
 	}
@@ -300,9 +281,9 @@ func GraphMerchantType(screen *ebiten.Image, cities []*City, title string, drawX
 		w := drawXZoom * 0.9
 		for _, city := range cities {
 			y := drawYOff + yOff
-			h := float64(points[good][city.name]) * drawYZoom
+			h := float64(points[good][city.Name()]) * drawYZoom
 
-			ebitenutil.DrawRect(screen, x, y-h, w, h, city.color)
+			ebitenutil.DrawRect(screen, x, y-h, w, h, city.Color())
 
 			yOff -= h
 		}
@@ -311,3 +292,19 @@ func GraphMerchantType(screen *ebiten.Image, cities []*City, title string, drawX
 		xIndex++
 	}
 }
+
+// DrawMetrics will print the inequality and welfare metrics of each city
+func DrawMetrics(screen *ebiten.Image, cities []*economy.City, title string, drawXOff, drawYOff float64) {
+	ebitenutil.DebugPrintAt(screen, title, int(drawXOff), int(drawYOff))
+	ebitenutil.DebugPrintAt(screen, "city        gini  worth gini  top 10%  utility  leisure", int(drawXOff), int(drawYOff)+15)
+
+	for i, city := range cities {
+		metrics := analytics.Compute(city)
+		line := fmt.Sprintf("%-10s  %.2f  %.2f        %.2f     %7.0f  %d",
+			city.Name(), metrics.MoneyGini, metrics.NetWorthGini, metrics.TopTenPercentShare, metrics.TotalUtility, metrics.LeisureTaken)
+
+		y := int(drawYOff) + 30 + 15*i
+		ebitenutil.DrawRect(screen, drawXOff-10, float64(y)+4, 6, 6, city.Color())
+		ebitenutil.DebugPrintAt(screen, line, int(drawXOff), y)
+	}
+}
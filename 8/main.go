@@ -1,18 +1,16 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"flag"
 	"fmt"
-	"image/color"
-	"math/rand"
-	"os"
-	"strings"
 	"time"
 
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/inpututil"
 	"github.com/jasonfantl/SimulatedEconomy8/economy"
-	"golang.org/x/exp/maps"
+	"github.com/jasonfantl/SimulatedEconomy8/graphing"
 )
 
 // Game is required by ebiten
@@ -21,7 +19,12 @@ type Game struct {
 
 var previousTime time.Time
 
-var cities []*economy.City
+var simulation *economy.Simulation
+
+var errUserQuit = errors.New("user quit")
+
+// how long networked cities get to hand over their merchants and say goodbye when the window closes
+const shutdownTimeout = 5 * time.Second
 
 // Update will be called at 60 FPS
 func (g *Game) Update() error {
@@ -29,17 +32,17 @@ func (g *Game) Update() error {
 	now := time.Now()
 	elapsed := now.Sub(previousTime)
 	if elapsed.Milliseconds() > 10 {
-		for _, city := range cities {
-			city.Update()
-		}
+		simulation.Step()
 		previousTime = now
 	}
 
 	for _, p := range inpututil.AppendPressedKeys(make([]ebiten.Key, 1)) {
 		if p == ebiten.KeyEscape {
-			return errors.New("user quit")
+			return errUserQuit
 		} else if p == ebiten.KeyAlt && inpututil.IsKeyJustPressed(p) {
-			cities[0].CreateTravelWayToCity("127.0.0.1:55555")
+			if err := simulation.Cities()[0].CreateTravelWayToCity(fmt.Sprintf("127.0.0.1:%d", economy.DefaultNetworkPort)); err != nil {
+				fmt.Println(err)
+			}
 		}
 	}
 
@@ -48,15 +51,17 @@ func (g *Game) Update() error {
 
 // Draw is called after Update to display to the screen
 func (g *Game) Draw(screen *ebiten.Image) {
-	economy.GraphExpectedValues(screen, "Price of Wood", economy.WOOD, 100, 200, 0.2, 20.0, 800, 200, 1)
-	economy.GraphExpectedValues(screen, "Price of Chairs", economy.CHAIR, 100, 400, 0.2, 4.0, 800, 200, 5)
-	economy.GraphExpectedValues(screen, "Price of Fur", economy.FUR, 350, 200, 0.2, 20.0, 800, 200, 1)
-	economy.GraphExpectedValues(screen, "Price of Bed", economy.BED, 350, 400, 0.2, 2.0, 800, 200, 10)
-
-	economy.GraphMerchantType(screen, cities, "Merchant types", 80, 600, 40, 5)
-	for _, city := range cities {
-		economy.GraphLeisureVWealth(screen, *city, "Leisure V Wealth", 300, 600, 0.1, 10, 250, 2)
+	graphing.GraphExpectedValues(screen, simulation, "Price of Wood", economy.WOOD, 100, 200, 0.2, 20.0, 800, 200, 1)
+	graphing.GraphExpectedValues(screen, simulation, "Price of Chairs", economy.CHAIR, 100, 400, 0.2, 4.0, 800, 200, 5)
+	graphing.GraphExpectedValues(screen, simulation, "Price of Fur", economy.FUR, 350, 200, 0.2, 20.0, 800, 200, 1)
+	graphing.GraphExpectedValues(screen, simulation, "Price of Bed", economy.BED, 350, 400, 0.2, 2.0, 800, 200, 10)
+
+	graphing.GraphMerchantType(screen, simulation.Cities(), "Merchant types", 80, 600, 40, 5)
+	for _, city := range simulation.Cities() {
+		graphing.GraphLeisureVWealth(screen, city, "Leisure V Wealth", 300, 600, 0.1, 10, 250, 2)
 	}
+
+	graphing.DrawMetrics(screen, simulation.Cities(), "Inequality and welfare", 30, 690)
 }
 
 // Layout determins the window size
@@ -64,37 +69,75 @@ func (g *Game) Layout(outsideWidth, outsideHeight int) (int, int) {
 	return outsideWidth, outsideHeight
 }
 
-var locationColors = map[string]color.Color{
-	"RIVERWOOD":  color.RGBA{58, 158, 33, 100},
-	"SEASIDE":    color.RGBA{10, 159, 227, 100},
-	"WINTERHOLD": color.RGBA{255, 255, 255, 100},
-	"PORTSVILLE": color.RGBA{128, 0, 0, 100},
-}
-
 func main() {
-	rand.Seed(time.Now().Unix())
+	scenarioPath := flag.String("scenario", "scenarios/twoCities.json", "scenario file describing the cities and events")
+	seed := flag.Int64("seed", 0, "seed for the random number generators, overrides the scenario's seed when set")
+	secret := flag.String("secret", "", "shared secret that signs messages to networked cities, they must use the same one")
+	registry := flag.String("registry", "", "advertise the cities at this registry, see cmd/registry")
+	topologyPath := flag.String("topology", "", "connect to the cities this topology file names as they appear at the registry")
+	flag.Parse()
+
+	scenario, err := economy.LoadScenario(*scenarioPath)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "seed" {
+			scenario.Seed = *seed
+		}
+	})
+	fmt.Printf("seed: %d\n", scenario.Seed)
+
+	simulation, err = scenario.Build()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, city := range simulation.Cities() {
+		city.Ledger().KeepLast(1000) // we run forever, so don't keep every trade
+		city.SetNetworkSecret(*secret)
+		if err := city.Listen(economy.DefaultNetworkPort); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+
+	topology := economy.Topology{}
+	if *topologyPath != "" {
+		if *registry == "" {
+			*registry = economy.DefaultRegistryAddress
+		}
+		topology, err = economy.LoadTopology(*topologyPath)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+	if *registry != "" {
+		for _, city := range simulation.Cities() {
+			if err := city.JoinMesh(*registry, topology); err != nil {
+				fmt.Println(err)
+				return
+			}
+		}
+	}
+
 	game := &Game{}
 
-	ebiten.SetWindowSize(650, 750)
+	ebiten.SetWindowSize(650, 800)
 	ebiten.SetWindowTitle("Economy Simulation")
 
-	cityNames := os.Args[1:]
+	err = ebiten.RunGame(game)
 
-	cities = make([]*economy.City, len(cityNames))
-	for i, name := range cityNames {
-		name = strings.ToUpper(name)
-		if col, ok := locationColors[name]; ok {
-			cities[i] = economy.NewCity(name, col, 20)
-		} else {
-			fmt.Println("Currently only support cities: " + strings.Join(maps.Keys(locationColors), ", "))
-		}
+	// leave the network cleanly, so connected cities get their merchants back instead of waiting for us
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if closeErr := simulation.Close(ctx); closeErr != nil {
+		fmt.Println(closeErr)
 	}
 
-	// add connections between cities
-	economy.RegisterTravelWay(cities[0], cities[1])
-	economy.RegisterTravelWay(cities[1], cities[0])
-
-	if err := ebiten.RunGame(game); err != nil {
+	if err != nil && err != errUserQuit {
 		panic(err)
 	}
 }
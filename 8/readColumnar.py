@@ -0,0 +1,53 @@
+# loads a columnar file written by Recorder.WriteColumnar into a pandas DataFrame
+# usage: python readColumnar.py run.col
+import struct
+import sys
+
+import numpy as np
+import pandas as pd
+
+MAGIC = b"ECONCOL\x01"
+
+
+def read_columnar(path):
+    with open(path, "rb") as f:
+        data = f.read()
+
+    if data[:8] != MAGIC:
+        raise ValueError("not an economy columnar file (or an unsupported version)")
+    offset = 8
+
+    rows, column_count = struct.unpack_from("<QI", data, offset)
+    offset += 12
+
+    header = []
+    for _ in range(column_count):
+        (name_length,) = struct.unpack_from("<H", data, offset)
+        offset += 2
+        name = data[offset:offset + name_length].decode()
+        offset += name_length
+        header.append((name, data[offset]))
+        offset += 1
+
+    columns = {}
+    for name, column_type in header:
+        if column_type == 0:
+            columns[name] = np.frombuffer(data, dtype="<i8", count=rows, offset=offset)
+            offset += 8 * rows
+        elif column_type == 1:
+            columns[name] = np.frombuffer(data, dtype="<f8", count=rows, offset=offset)
+            offset += 8 * rows
+        else:
+            values = []
+            for _ in range(rows):
+                (length,) = struct.unpack_from("<I", data, offset)
+                offset += 4
+                values.append(data[offset:offset + length].decode())
+                offset += length
+            columns[name] = values
+
+    return pd.DataFrame(columns)
+
+
+if __name__ == "__main__":
+    print(read_columnar(sys.argv[1]))